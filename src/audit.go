@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// auditEntry is a single request made to Datadog, written as a line of JSON.
+type auditEntry struct {
+	Time   string `json:"time"`
+	Target string `json:"target,omitempty"`
+	Method string `json:"method"`
+	// The path of the request, with any keys redacted.
+	Path string `json:"path"`
+	// The status Datadog responded with, zero if it never responded.
+	Status    int   `json:"status,omitempty"`
+	LatencyMS int64 `json:"latency_ms"`
+	// How many times the request was retried, on top of the first attempt.
+	Retries int `json:"retries"`
+	// The YAML file the request was made for, if any.
+	File  string `json:"file,omitempty"`
+	Error string `json:"error,omitempty"`
+	// The bodies are only logged in debug mode.
+	RequestBody  string `json:"request_body,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+}
+
+// auditLog writes an auditEntry for every request made to Datadog, so what a run changed, and
+// when, can be worked out after the fact.
+type auditLog struct {
+	// Entries from every worker, and target are written to the same writer.
+	lock *sync.Mutex
+	w    io.Writer
+	// debug logs the body of every request, and response as well.
+	debug bool
+	// The target the requests are made to.
+	target string
+}
+
+// newAuditLog creates an audit log writing to w.
+func newAuditLog(w io.Writer, debug bool) *auditLog {
+	return &auditLog{lock: &sync.Mutex{}, w: w, debug: debug}
+}
+
+// forTarget returns an audit log that labels its entries with a target, sharing w.
+func (audit *auditLog) forTarget(target string) *auditLog {
+	labelled := *audit
+	labelled.target = target
+	return &labelled
+}
+
+// write writes a single entry as a line of JSON.
+func (audit *auditLog) write(entry auditEntry) error {
+	entry.Target = audit.target
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	audit.lock.Lock()
+	defer audit.lock.Unlock()
+	_, err = audit.w.Write(append(data, '\n'))
+	return err
+}
+
+// SetAuditLog has the connector write an entry for every request it makes to w. With debug,
+// the bodies of every request, and response are written too.
+func (client *DatadogConnector) SetAuditLog(w io.Writer, debug bool) {
+	client.audit = newAuditLog(w, debug)
+}
+
+// forFile returns a connector whose requests are logged against a YAML file. It shares its
+// client, rate limiter, and audit log with the original.
+func (client *DatadogConnector) forFile(path string) *DatadogConnector {
+	if client.audit == nil {
+		return client
+	}
+	scoped := *client
+	scoped.file = path
+	return &scoped
+}
+
+// logRequest writes the audit entry of a request. In debug mode the response body is read to
+// be logged, and replaced so the caller can still read it.
+func (client *DatadogConnector) logRequest(req *http.Request, body []byte, resp *http.Response, attempts int, start time.Time, err error) {
+	if client.audit == nil {
+		return
+	}
+	entry := auditEntry{
+		Time:      start.UTC().Format(time.RFC3339Nano),
+		Method:    req.Method,
+		Path:      client.redact(req.URL.RequestURI()),
+		LatencyMS: int64(time.Since(start) / time.Millisecond),
+		Retries:   attempts - 1,
+		File:      client.file,
+	}
+	if entry.Retries < 0 {
+		entry.Retries = 0
+	}
+	if resp != nil {
+		entry.Status = resp.StatusCode
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if client.audit.debug {
+		entry.RequestBody = client.redact(string(body))
+		if resp != nil {
+			data, readErr := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+			if readErr != nil {
+				entry.Error = readErr.Error()
+			}
+			entry.ResponseBody = client.redact(string(data))
+		}
+	}
+	// A failure to write the audit log shouldn't fail the request it's about.
+	client.audit.write(entry)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+// readAuditLog parses every entry written to an audit log.
+func readAuditLog(t *testing.T, log *bytes.Buffer) []auditEntry {
+	entries := []auditEntry{}
+	for _, line := range strings.Split(strings.TrimSpace(log.String()), "\n") {
+		var entry auditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Audit log line isn't JSON: [ %s ]", line)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAuditLog(t *testing.T) {
+	t.Run("Logs Every Request", func(t *testing.T) {
+		defer gock.Off()
+		gock.New(testDatadogHost()).
+			Post("/api/v1/screen$").
+			Reply(429).
+			SetHeader("X-RateLimit-Reset", "1")
+		gock.New(testDatadogHost()).
+			Post("/api/v1/screen$").
+			Reply(200).
+			JSON(map[string]interface{}{"id": 42})
+		gock.New(testDatadogHost()).
+			Get("/api/v1/screen/42$").
+			Reply(404).
+			BodyString("not found")
+
+		var log bytes.Buffer
+		connector := NewDatadogConnector("secret-api", "secret-app", 3)
+		connector.limiter.sleep = func(time.Duration) {}
+		connector.SetAuditLog(&log, false)
+		if _, err := connector.forFile("screens/a.yml").UpsertBoard(ScreenKind, "", map[string]interface{}{"board_title": "Screen"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := connector.GetBoard(ScreenKind, "42"); err == nil {
+			t.Fatal("Missing board wasn't an error")
+		}
+
+		entries := readAuditLog(t, &log)
+		if len(entries) != 2 {
+			t.Fatalf("Expected an entry per request: [ %s ]", log.String())
+		}
+		post, get := entries[0], entries[1]
+		if post.Method != "POST" || post.Path != "/api/v1/screen" || post.Status != 200 || post.Retries != 1 || post.File != "screens/a.yml" || post.Time == "" {
+			t.Fatalf("Post wasn't logged: [ %+v ]", post)
+		}
+		if get.Method != "GET" || get.Path != "/api/v1/screen/42" || get.Status != 404 || get.Retries != 0 || get.File != "" {
+			t.Fatalf("Get wasn't logged: [ %+v ]", get)
+		}
+		if post.RequestBody != "" || post.ResponseBody != "" {
+			t.Fatalf("Bodies should only be logged in debug mode: [ %+v ]", post)
+		}
+	})
+
+	t.Run("Debug Logs Bodies", func(t *testing.T) {
+		defer gock.Off()
+		gock.New(testDatadogHost()).
+			Post("/api/v1/screen$").
+			Reply(200).
+			JSON(map[string]interface{}{"id": 42, "note": "made with secret-api"})
+
+		var log bytes.Buffer
+		connector := NewDatadogConnector("secret-api", "secret-app", 3)
+		connector.SetAuditLog(&log, true)
+		id, err := connector.UpsertBoard(ScreenKind, "", map[string]interface{}{"board_title": "Screen"})
+		if err != nil || id != "42" {
+			t.Fatalf("Response couldn't be read after it was logged: [ %s, %+v ]", id, err)
+		}
+
+		entries := readAuditLog(t, &log)
+		if len(entries) != 1 || entries[0].RequestBody != `{"board_title":"Screen"}` {
+			t.Fatalf("Request body wasn't logged: [ %s ]", log.String())
+		}
+		if !strings.Contains(entries[0].ResponseBody, `"id":42`) || strings.Contains(log.String(), "secret-api") {
+			t.Fatalf("Response body wasn't logged with the keys redacted: [ %s ]", log.String())
+		}
+	})
+}
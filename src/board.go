@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// BoardKind describes one of the Datadog board APIs Greyhound can manage.
+type BoardKind struct {
+	// Name is the short name of the kind used in output.
+	Name string
+	// APIPath is the API path boards of this kind live under.
+	APIPath string
+	// TitleKey is the key in the payload holding the title of the board.
+	TitleKey string
+}
+
+var (
+	// DashKind is a timeboard, managed through /v1/dash.
+	DashKind = BoardKind{"dash", "/v1/dash", "title"}
+	// ScreenKind is a screenboard, managed through /v1/screen.
+	ScreenKind = BoardKind{"screen", "/v1/screen", "board_title"}
+	// DashboardKind is a dashboard, managed through the unified /v1/dashboard API. Its
+	// layout_type decides if it's laid out like a timeboard (ordered), or a screenboard (free).
+	DashboardKind = BoardKind{"dashboard", "/v1/dashboard", "title"}
+)
+
+// LiveBoard is a board that currently exists in Datadog.
+type LiveBoard struct {
+	ID    string
+	Title string
+}
+
+// toJSONMap converts a map parsed from yaml into one that is safe to hand to encoding/json.
+func toJSONMap(in interface{}) (map[string]interface{}, error) {
+	marshaled, err := yaml.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	asBytes, err := yamlToJSON(marshaled, nil)
+	if err != nil {
+		return nil, err
+	}
+	var fromJSON map[string]interface{}
+	if err = json.Unmarshal(asBytes, &fromJSON); err != nil {
+		return nil, err
+	}
+	return fromJSON, nil
+}
+
+// Payload turns a parsed template into the JSON body Datadog expects for this kind of board.
+// A nil payload means the template doesn't describe a board at all.
+func (kind BoardKind) Payload(doc map[string]interface{}) (map[string]interface{}, error) {
+	var board interface{} = doc
+	if kind == DashKind {
+		dashFrd := getDashAsMap(doc)
+		if dashFrd == nil {
+			return nil, nil
+		}
+		board = dashFrd
+	}
+	return toJSONMap(board)
+}
+
+// Title grabs the title out of a payload.
+func (kind BoardKind) Title(payload map[string]interface{}) (string, error) {
+	title, ok := payload[kind.TitleKey].(string)
+	if !ok || title == "" {
+		return "", fmt.Errorf("%s has no %s", kind.Name, kind.TitleKey)
+	}
+	return title, nil
+}
+
+// payloadAndTitle builds the payload for a template, and grabs its title. A nil payload means
+// the template doesn't describe a board.
+func (kind BoardKind) payloadAndTitle(template Template) (map[string]interface{}, string, error) {
+	payload, err := kind.Payload(template.Contents)
+	if err != nil || payload == nil {
+		return nil, "", err
+	}
+	title, err := kind.Title(payload)
+	if err != nil {
+		return nil, "", err
+	}
+	return payload, title, nil
+}
+
+// ListBoards lists every board of a kind that currently exists in Datadog.
+func (client *DatadogConnector) ListBoards(kind BoardKind) ([]LiveBoard, error) {
+	boards := []LiveBoard{}
+	switch kind {
+	case DashKind:
+		var out DashboardListResp
+		if err := client.DoJSONRequest("GET", kind.APIPath, nil, &out); err != nil {
+			return nil, err
+		}
+		for _, dash := range out.Dashboards {
+			if dash.ID == nil || dash.Title == nil {
+				continue
+			}
+			boards = append(boards, LiveBoard{*dash.ID, *dash.Title})
+		}
+	case ScreenKind:
+		var out ScreensListResp
+		if err := client.DoJSONRequest("GET", kind.APIPath, nil, &out); err != nil {
+			return nil, err
+		}
+		for _, screen := range out.Dashboards {
+			if screen.ID == nil || screen.Title == nil {
+				continue
+			}
+			boards = append(boards, LiveBoard{strconv.Itoa(*screen.ID), *screen.Title})
+		}
+	case DashboardKind:
+		var out UnifiedDashboardListResp
+		if err := client.DoJSONRequest("GET", kind.APIPath, nil, &out); err != nil {
+			return nil, err
+		}
+		for _, dashboard := range out.Dashboards {
+			if dashboard.ID == nil || dashboard.Title == nil {
+				continue
+			}
+			boards = append(boards, LiveBoard{*dashboard.ID, *dashboard.Title})
+		}
+	default:
+		return nil, fmt.Errorf("Unknown board kind: %s", kind.Name)
+	}
+	return boards, nil
+}
+
+// GetBoard fetches the full definition of a live board, in the same shape as Payload.
+func (client *DatadogConnector) GetBoard(kind BoardKind, id string) (map[string]interface{}, error) {
+	var out map[string]interface{}
+	if err := client.DoJSONRequest("GET", fmt.Sprintf("%s/%s", kind.APIPath, id), nil, &out); err != nil {
+		return nil, err
+	}
+	if kind == DashKind {
+		dash, ok := out["dash"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Response from datadog had no valid dashboard: %+v", out)
+		}
+		return dash, nil
+	}
+	return out, nil
+}
+
+// boardIndex indexes the live boards of a kind, in order to find which board a template owns.
+type boardIndex struct {
+	byID    map[string]LiveBoard
+	byTitle map[string]LiveBoard
+}
+
+// newBoardIndex indexes a list of live boards.
+func newBoardIndex(boards []LiveBoard) *boardIndex {
+	index := &boardIndex{make(map[string]LiveBoard), make(map[string]LiveBoard)}
+	for _, board := range boards {
+		index.byID[board.ID] = board
+		index.byTitle[board.Title] = board
+	}
+	return index
+}
+
+// match finds the live board a template should update. The board recorded in state wins,
+// so renaming a title updates the same board. Otherwise we fall back to a board with the
+// same title.
+func (index *boardIndex) match(kind BoardKind, state *BoardState, title string) (LiveBoard, bool) {
+	if state != nil && state.Kind == kind.Name {
+		if board, ok := index.byID[state.ID]; ok {
+			return board, true
+		}
+	}
+	board, ok := index.byTitle[title]
+	return board, ok
+}
+
+// idFromResponse pulls the ID out of a board returned by Datadog. Datadog isn't consistent
+// about returning IDs as numbers, or strings so we accept both.
+func idFromResponse(board map[string]interface{}) string {
+	switch id := board["id"].(type) {
+	case string:
+		return id
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64)
+	}
+	return ""
+}
+
+// UpsertBoard creates a board when id is empty, and otherwise updates the board with that id
+// in place. Updating in place rather than recreating keeps the ID, and with it every link to the
+// board, stable across deploys. The ID of the board is returned.
+func (client *DatadogConnector) UpsertBoard(kind BoardKind, id string, payload map[string]interface{}) (string, error) {
+	id, _, err := client.writeBoard(kind, id, payload)
+	return id, err
+}
+
+// writeBoard is UpsertBoard, also returning the URL of the board in the web app.
+func (client *DatadogConnector) writeBoard(kind BoardKind, id string, payload map[string]interface{}) (string, string, error) {
+	method, path := "POST", kind.APIPath
+	if id != "" {
+		method, path = "PUT", fmt.Sprintf("%s/%s", kind.APIPath, id)
+	}
+	var raw json.RawMessage
+	if err := client.DoJSONRequest(method, path, payload, &raw); err != nil {
+		return "", "", err
+	}
+	var resp CreateDashboardResp
+	var out map[string]interface{}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return "", "", err
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return "", "", err
+	}
+	url := ""
+	if resp.URL != nil {
+		url = *resp.URL
+	}
+	if id != "" {
+		return id, client.boardURL(kind, id, url), nil
+	}
+
+	created := out
+	if kind == DashKind {
+		created = resp.Dashboard
+	}
+	if id = idFromResponse(created); id == "" {
+		return "", "", fmt.Errorf("Response from datadog had no valid %s: %+v", kind.Name, out)
+	}
+	return id, client.boardURL(kind, id, url), nil
+}
+
+// boardURL is the URL of a board in the web app. Datadog returns the path of the board as url
+// when it's written (see CreateDashboardResp), which is used when it's there, as it's the only
+// way to get the slug of a dashboard. Otherwise the path is built from the ID.
+func (client *DatadogConnector) boardURL(kind BoardKind, id string, path string) string {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = fmt.Sprintf("/%s/%s", kind.Name, id)
+	}
+	return client.Site.AppURL() + path
+}
+
+// lazyBoardIndex lists the live boards of a kind the first time they're needed, so a run
+// where nothing changed never has to talk to Datadog.
+type lazyBoardIndex struct {
+	client *DatadogConnector
+	kind   BoardKind
+	index  *boardIndex
+}
+
+// get returns the index, listing the live boards if they haven't been yet.
+func (lazy *lazyBoardIndex) get() (*boardIndex, error) {
+	if lazy.index != nil {
+		return lazy.index, nil
+	}
+	live, err := lazy.client.ListBoards(lazy.kind)
+	if err != nil {
+		return nil, err
+	}
+	lazy.index = newBoardIndex(live)
+	return lazy.index, nil
+}
+
+// SyncOptions controls how boards are synced to Datadog.
+type SyncOptions struct {
+	// Force pushes every board, even ones whose file hasn't changed since it was last applied.
+	Force bool
+	// Prune deletes boards Greyhound created whose file has since been removed.
+	Prune bool
+	// KeepGoing carries on past a file that fails, reporting every failure at the end.
+	KeepGoing bool
+	// Concurrency is how many boards are written to Datadog at once. Anything less than one
+	// writes them one at a time.
+	Concurrency int
+	// SkipState neither reads, nor records which board each file owns, so boards are matched by
+	// their title alone. It's for pushing boards to an org they aren't deployed to, like a sandbox.
+	SkipState bool
+}
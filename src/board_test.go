@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestIdFromResponse(t *testing.T) {
+	if id := idFromResponse(map[string]interface{}{"id": 1234567.0}); id != "1234567" {
+		t.Fatalf("Numeric ID was not formatted correctly: %s", id)
+	}
+	if id := idFromResponse(map[string]interface{}{"id": "abc-123"}); id != "abc-123" {
+		t.Fatalf("String ID was not returned as is: %s", id)
+	}
+	if id := idFromResponse(map[string]interface{}{}); id != "" {
+		t.Fatalf("Missing ID was not empty: %s", id)
+	}
+}
+
+func TestPlanAndApplyDashboards(t *testing.T) {
+	defer gock.Off()
+
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"new.yml":      "---\ntitle: New\nlayout_type: ordered\nwidgets: []\n",
+		"existing.yml": "---\ntitle: Existing\nlayout_type: free\nwidgets: []\n",
+	})
+	defer cleanup()
+
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dashboard$").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"dashboards": []map[string]interface{}{{"id": "abc-def-ghi", "title": "Existing", "layout_type": "free"}},
+		})
+	gock.New(testDatadogHost()).
+		Post("/api/v1/dashboard$").
+		Reply(200).
+		JSON(map[string]interface{}{"id": "jkl-mno-pqr", "title": "New", "layout_type": "ordered"})
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dashboard/abc-def-ghi$").
+		Reply(200).
+		JSON(map[string]interface{}{"id": "abc-def-ghi", "title": "Existing", "layout_type": "ordered", "widgets": []interface{}{}})
+	gock.New(testDatadogHost()).
+		Put("/api/v1/dashboard/abc-def-ghi$").
+		Reply(200).
+		JSON(map[string]interface{}{})
+
+	connector := NewDatadogConnector("test", "test", 3)
+	plan, err := connector.BuildPlan(DashboardKind, fs, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = connector.ApplyPlan(plan, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !gock.IsDone() {
+		t.Fatal("Applying the plan didn't create, and update the dashboards!")
+	}
+	state, err := fs.GetState("src/configs/new.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state == nil || state.Kind != "dashboard" || state.ID != "jkl-mno-pqr" {
+		t.Fatalf("Applying the plan didn't record the created dashboard: [ %+v ]", state)
+	}
+}
@@ -0,0 +1,692 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// The exit codes of every command, so scripts can tell a failure apart from a difference.
+const (
+	// exitOK means the command did everything it was asked to.
+	exitOK = 0
+	// exitFailure means something went wrong, like a board that failed to render, or Datadog
+	// returning an error.
+	exitFailure = 1
+	// exitDifferences means the command worked, but found differences it was asked to report
+	// e.g. drift, or diff finding boards that don't match their YAML.
+	exitDifferences = 2
+	// exitUsage means the command was used wrongly, or Greyhound is misconfigured.
+	exitUsage = 3
+)
+
+// version is the version of Greyhound, set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// errDifferences is returned by a command that found differences, which it reports through its
+// exit code rather than as a failure.
+var errDifferences = errors.New("differences found")
+
+// usageError is a command being used wrongly, rather than failing.
+type usageError struct {
+	msg string
+}
+
+func (err *usageError) Error() string {
+	return err.msg
+}
+
+// runFunc carries out a command, with the arguments left over after its flags.
+type runFunc func(run *commandRun, args []string) error
+
+// command is a single subcommand of greyhound.
+type command struct {
+	name string
+	// Old names the command can still be run by, with a warning that they're deprecated.
+	aliases []string
+	// The arguments the command takes, for usage.
+	args string
+	// A single line describing the command.
+	summary string
+	// Describes the command in full.
+	help string
+	// boards is set for commands that read boards, so they take the config flags.
+	boards bool
+	// setup adds the command's own flags, and returns the function that runs it.
+	setup func(flags *flag.FlagSet) runFunc
+}
+
+// cli runs greyhound's commands against a file system, and environment.
+type cli struct {
+	appFs  afero.Fs
+	getenv func(string) string
+	out    io.Writer
+	errOut io.Writer
+}
+
+// commandRun is everything a running command needs.
+type commandRun struct {
+	*cli
+	cfg    *Config
+	target *Target
+	audit  *auditLog
+	boards []managedBoards
+	client *DatadogConnector
+}
+
+// connect creates the client for Datadog the first time it's needed, and makes sure its
+// credentials are valid. Commands that never call it never need credentials.
+func (run *commandRun) connect() (*DatadogConnector, error) {
+	if run.client != nil {
+		return run.client, nil
+	}
+	client, err := run.cfg.Connector(run.target)
+	if err != nil {
+		return nil, &usageError{err.Error()}
+	}
+	if run.audit != nil {
+		client.audit = run.audit.forTarget(run.target.Name)
+	}
+	isValid, err := client.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query datadog: %v", err)
+	}
+	if !isValid {
+		return nil, fmt.Errorf("Datadog Credentials aren't valid")
+	}
+	run.client = client
+	return client, nil
+}
+
+// syncOptions builds the SyncOptions of a run from the flags of a command.
+func (run *commandRun) syncOptions(force bool, prune bool, keepGoing bool) SyncOptions {
+	return SyncOptions{Force: force, Prune: prune, KeepGoing: keepGoing, Concurrency: run.cfg.Concurrency}
+}
+
+// noArgs wraps a runFunc for a command that doesn't take any arguments.
+func noArgs(fn runFunc) runFunc {
+	return func(run *commandRun, args []string) error {
+		if len(args) > 0 {
+			return &usageError{fmt.Sprintf("Unexpected arguments: %s", strings.Join(args, " "))}
+		}
+		return fn(run, args)
+	}
+}
+
+// commands is every command of greyhound, in the order they're listed in help.
+var commands = []*command{
+	{
+		name:    "render",
+		args:    "[files...]",
+		summary: "Print the request body of every board, exactly as it would be sent to Datadog.",
+		help: `Renders every board offline, through templating, partials, and the env's overlay, and
+prints the request body Datadog would be sent for each, with the board each is for printed to
+stderr. Only the boards rendered from the given files are rendered if any are given. With --out a file is written per board, named
+after the file it came from, so rendered boards can be diffed in review.`,
+		boards: true,
+		setup: func(flags *flag.FlagSet) runFunc {
+			opts := RenderOptions{}
+			flags.StringVar(&opts.Format, "format", renderJSON, fmt.Sprintf("The format to render boards in, %s, or %s.", renderJSON, renderYAML))
+			flags.BoolVar(&opts.Compact, "compact", false, "Print JSON byte for byte as it's sent, rather than indented.")
+			flags.StringVar(&opts.OutDir, "out", "", "The directory to write a file per board to, rather than printing them.")
+			flags.BoolVar(&opts.KeepGoing, "keep-going", false, "Carry on past files that fail, and report every failure at the end.")
+			return func(run *commandRun, args []string) error {
+				if opts.Format != renderJSON && opts.Format != renderYAML {
+					return &usageError{fmt.Sprintf("Unknown format %q, expected %s, or %s", opts.Format, renderJSON, renderYAML)}
+				}
+				targetOpts := opts
+				if opts.OutDir != "" && run.target.Name != "" {
+					targetOpts.OutDir = filepath.Join(opts.OutDir, run.target.Name)
+				}
+				// Bodies aren't labelled with the target, so they can be piped straight into jq. The
+				// board each is for goes to errOut, which still is.
+				out := run.out
+				if labelled, ok := out.(*prefixWriter); ok && opts.OutDir == "" {
+					out = labelled.w
+				}
+				return RenderBoards(out, run.errOut, run.appFs, run.boards, args, targetOpts)
+			}
+		},
+	},
+	{
+		name:    "validate",
+		summary: "Check every board against the schema of its kind.",
+		help: `Validates every board offline against the schema of its kind, reporting every problem
+found with the file, and line it's on. With --remote every board is also created in
+Datadog, and deleted again, to check Datadog accepts it.`,
+		boards: true,
+		setup: func(flags *flag.FlagSet) runFunc {
+			remote := flags.Bool("remote", false, "Also create, and delete every board in Datadog to check it's accepted.")
+			keepGoing := flags.Bool("keep-going", false, "With --remote, carry on past boards that fail.")
+			return noArgs(func(run *commandRun, args []string) error {
+				errs, err := validateBoards(run.boards)
+				if err != nil {
+					return err
+				}
+				for _, validationErr := range errs {
+					fmt.Fprintln(run.out, validationErr)
+				}
+				if len(errs) > 0 {
+					return fmt.Errorf("Found %d problems", len(errs))
+				}
+				if *remote {
+					client, err := run.connect()
+					if err != nil {
+						return err
+					}
+					opts := run.syncOptions(false, false, *keepGoing)
+					for _, managed := range run.boards {
+						fmt.Fprintf(run.out, "Creating, and deleting %s boards in Datadog...\n", managed.kind.Name)
+						if err = client.dryRunBoards(managed.kind, managed.fs, opts); err != nil {
+							return err
+						}
+					}
+				}
+				fmt.Fprintln(run.out, "Successful!")
+				return nil
+			})
+		},
+	},
+	{
+		name:    "plan",
+		summary: "Show the changes apply would make to Datadog.",
+		help: `Compares every board against Datadog, and prints the changes needed to make Datadog match
+YAML. Nothing is written to Datadog. Files that haven't changed since they were last
+applied are skipped, unless --force is given.`,
+		boards: true,
+		setup: func(flags *flag.FlagSet) runFunc {
+			force := flags.Bool("force", false, "Compare every board, even ones that haven't changed since they were last applied.")
+			prune := flags.Bool("prune", false, "Plan the deletion of boards Greyhound created whose YAML file has been removed.")
+			keepGoing := flags.Bool("keep-going", false, "Leave files that fail out of the plan, and report every failure at the end.")
+			detailed := flags.Bool("detailed-exitcode", false, fmt.Sprintf("Exit with %d when the plan has changes.", exitDifferences))
+			return noArgs(func(run *commandRun, args []string) error {
+				plan, err := run.plan(run.syncOptions(*force, *prune, *keepGoing))
+				if err != nil {
+					return err
+				}
+				if *detailed && plan.HasChanges() {
+					return errDifferences
+				}
+				return nil
+			})
+		},
+	},
+	{
+		name:    "apply",
+		summary: "Make Datadog match YAML.",
+		help: `Builds the same plan as plan, prints it, and carries out only those changes. Boards that
+already exist are updated in place, so their IDs stay the same. With --report the result of
+every board, and a link to it, is written to a file for CI to pick up.`,
+		boards: true,
+		setup: func(flags *flag.FlagSet) runFunc {
+			force := flags.Bool("force", false, "Push every board, even ones that haven't changed since they were last applied.")
+			prune := flags.Bool("prune", false, "Delete boards Greyhound created whose YAML file has been removed.")
+			keepGoing := flags.Bool("keep-going", false, "Carry on past files that fail, and report every failure at the end.")
+			reportPath := flags.String("report", "", "The file to write the result of every board to.")
+			reportFormat := flags.String("report-format", reportJSON, fmt.Sprintf("The format of the report, %s, or %s.", reportJSON, reportJUnit))
+			// Every target adds to the same report, which is rewritten after each so it's
+			// complete even when a later target stops the run.
+			report := &Report{Results: []BoardResult{}}
+			return noArgs(func(run *commandRun, args []string) error {
+				if *reportFormat != reportJSON && *reportFormat != reportJUnit {
+					return &usageError{fmt.Sprintf("Unknown report format %q, expected %s, or %s", *reportFormat, reportJSON, reportJUnit)}
+				}
+				results, err := run.apply(run.syncOptions(*force, *prune, *keepGoing))
+				if *reportPath != "" {
+					report.Add(run.target.Name, results)
+					if reportErr := report.Write(run.appFs, *reportPath, *reportFormat); reportErr != nil && err == nil {
+						err = reportErr
+					}
+				}
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(run.out, "Successful!")
+				return nil
+			})
+		},
+	},
+	{
+		name:    "import",
+		summary: "Write YAML for every live board Greyhound doesn't own yet.",
+		help: `Writes a YAML file for every board in Datadog that isn't owned by a file yet, and records
+the new file as its owner. Existing files are never overwritten.`,
+		boards: true,
+		setup: func(flags *flag.FlagSet) runFunc {
+			return noArgs(func(run *commandRun, args []string) error {
+				client, err := run.connect()
+				if err != nil {
+					return err
+				}
+				for _, managed := range run.boards {
+					fmt.Fprintf(run.out, "Importing %s boards...\n", managed.kind.Name)
+					written, err := client.ImportBoards(managed.kind, managed.fs)
+					for _, path := range written {
+						fmt.Fprintf(run.out, "  + %s\n", path)
+					}
+					if err != nil {
+						return err
+					}
+				}
+				fmt.Fprintln(run.out, "Successful!")
+				return nil
+			})
+		},
+	},
+	{
+		name:    "diff",
+		summary: "Show every difference between YAML, and Datadog.",
+		help: fmt.Sprintf(`Compares every board against Datadog, whether or not its file has changed since it was
+last applied, and prints every difference. Exits with %d when there are differences.`, exitDifferences),
+		boards: true,
+		setup: func(flags *flag.FlagSet) runFunc {
+			prune := flags.Bool("prune", false, "Include boards Greyhound created whose YAML file has been removed.")
+			keepGoing := flags.Bool("keep-going", false, "Leave files that fail out of the diff, and report every failure at the end.")
+			return noArgs(func(run *commandRun, args []string) error {
+				plan, err := run.plan(run.syncOptions(true, *prune, *keepGoing))
+				if err != nil {
+					return err
+				}
+				if plan.HasChanges() {
+					return errDifferences
+				}
+				return nil
+			})
+		},
+	},
+	{
+		name:    "drift",
+		summary: "Find boards that were changed outside of git.",
+		help: fmt.Sprintf(`Compares every board whose file hasn't changed since it was last applied against Datadog,
+and reports the ones that were changed, or deleted by hand. Exits with %d when any have
+drifted.`, exitDifferences),
+		boards: true,
+		setup: func(flags *flag.FlagSet) runFunc {
+			return noArgs(func(run *commandRun, args []string) error {
+				client, err := run.connect()
+				if err != nil {
+					return err
+				}
+				report, err := detectDrift(client, run.boards)
+				if err != nil {
+					return err
+				}
+				report.Write(run.out)
+				if len(report.Drifts) > 0 {
+					return errDifferences
+				}
+				return nil
+			})
+		},
+	},
+	{
+		name:    "watch",
+		summary: "Re-render boards as their YAML changes, and optionally push them.",
+		help: `Watches the directory of every kind of board for YAML files whose contents change, and
+re-renders, and validates only the boards that changed, printing how their rendered body
+changed. With --push the changed boards are written to Datadog instead, e.g. to a sandbox
+org picked with --targets. Removing a file never deletes its board. Runs until interrupted.`,
+		boards: true,
+		setup: func(flags *flag.FlagSet) runFunc {
+			push := flags.Bool("push", false, "Write every changed board to Datadog, rather than only printing how it renders.")
+			interval := flags.Duration("interval", time.Second, "How often to check for files that changed.")
+			return noArgs(func(run *commandRun, args []string) error {
+				if len(run.cfg.Targets) > 1 {
+					return &usageError{"watch runs against a single target, pick one with --targets"}
+				}
+				if *interval <= 0 {
+					return &usageError{fmt.Sprintf("Interval must be positive, got %s", *interval)}
+				}
+				var client *DatadogConnector
+				if *push {
+					var err error
+					if client, err = run.connect(); err != nil {
+						return err
+					}
+				}
+				ticker := time.NewTicker(*interval)
+				defer ticker.Stop()
+				interrupts := make(chan os.Signal, 1)
+				signal.Notify(interrupts, os.Interrupt)
+				defer signal.Stop(interrupts)
+				return watchBoards(run.out, run.errOut, client, run.boards, run.syncOptions(true, false, true), tickUntil(ticker.C, interrupts))
+			})
+		},
+	},
+	{
+		name:    "convert",
+		summary: "Convert timeboards, and screenboards into dashboards.",
+		help: `Converts every timeboard, and screenboard into a dashboard for the unified dashboard API,
+written to the dashboard path. Existing files are never overwritten.`,
+		boards: true,
+		setup: func(flags *flag.FlagSet) runFunc {
+			keepGoing := flags.Bool("keep-going", false, "Carry on past files that fail, and report every failure at the end.")
+			return noArgs(func(run *commandRun, args []string) error {
+				written, err := convertBoards(run.boards, run.syncOptions(false, false, *keepGoing))
+				for _, path := range written {
+					fmt.Fprintf(run.out, "  + %s\n", path)
+				}
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(run.out, "Successful!")
+				return nil
+			})
+		},
+	},
+	{
+		name:    "cache",
+		aliases: []string{"state"},
+		args:    "<list|rm|import> [args...]",
+		summary: "Manage the record of which file owns which board.",
+		help: `The cache records which board each file owns.
+
+  cache list                        Show which board each file owns.
+  cache rm <file>                   Forget which board a file owns, the board is left alone.
+  cache import <kind> <file> <id>   Have a file take ownership of an existing board.`,
+		boards: true,
+		setup: func(flags *flag.FlagSet) runFunc {
+			return runCacheCommand
+		},
+	},
+	{
+		name:    "version",
+		summary: "Print the version of Greyhound.",
+		help:    "Prints the version of Greyhound.",
+		setup: func(flags *flag.FlagSet) runFunc {
+			return noArgs(func(run *commandRun, args []string) error {
+				fmt.Fprintf(run.out, "greyhound %s\n", version)
+				return nil
+			})
+		},
+	},
+}
+
+// findCommand finds a command by its name, or one of its aliases.
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+		for _, alias := range cmd.aliases {
+			if alias == name {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+// plan builds, and prints the plan for a run. With opts.KeepGoing the plan is returned
+// alongside the files that failed.
+func (run *commandRun) plan(opts SyncOptions) (*Plan, error) {
+	client, err := run.connect()
+	if err != nil {
+		return nil, err
+	}
+	plan, planErr := buildPlan(client, run.boards, opts)
+	if plan == nil {
+		return nil, planErr
+	}
+	plan.Write(run.out)
+	return plan, planErr
+}
+
+// apply builds, prints, and applies the plan for a run, returning the result of every board
+// including the ones that failed.
+func (run *commandRun) apply(opts SyncOptions) ([]BoardResult, error) {
+	plan, planErr := run.plan(opts)
+	if plan == nil {
+		return failedResults(planErr), planErr
+	}
+	results := []BoardResult{}
+	if plan.HasChanges() {
+		fmt.Fprintln(run.out, "Applying Plan...")
+		applied, err := run.client.applyPlan(plan, opts)
+		results = append(results, applied...)
+		if err != nil {
+			return append(results, failedResults(planErr)...), err
+		}
+	} else {
+		// Nothing is written, but every board is still reported on.
+		for _, change := range plan.Changes {
+			if change.forget {
+				continue
+			}
+			result := change.result()
+			result.Action = ResultUnchanged
+			if change.ID != "" {
+				result.URL = run.client.boardURL(change.Kind, change.ID, "")
+			}
+			results = append(results, result)
+		}
+	}
+	return append(results, failedResults(planErr)...), planErr
+}
+
+// usage prints the commands of greyhound.
+func (c *cli) usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: greyhound <command> [flags] [args...]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "greyhound help <command>" for the flags of a command.`)
+}
+
+// printCommandHelp prints the usage, and flags of a command. The flags are printed to the
+// output of the FlagSet, which should be w.
+func printCommandHelp(w io.Writer, cmd *command, flags *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: greyhound %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.help)
+	flags.PrintDefaults()
+}
+
+// flagsFor builds the FlagSet of a command, returning it with the function that runs the
+// command.
+func (c *cli) flagsFor(cmd *command) (*flag.FlagSet, runFunc, *string) {
+	flags := flag.NewFlagSet("greyhound "+cmd.name, flag.ContinueOnError)
+	flags.SetOutput(c.errOut)
+	var env *string
+	if cmd.boards {
+		registerConfigFlags(flags)
+		env = flags.String("env", "", "The overlay to apply on top of the base boards, e.g. prod-us.")
+	}
+	fn := cmd.setup(flags)
+	flags.Usage = func() {
+		printCommandHelp(c.errOut, cmd, flags)
+	}
+	return flags, fn, env
+}
+
+// run runs the command given by args, returning the code greyhound should exit with.
+func (c *cli) run(args []string) int {
+	if len(args) == 0 {
+		c.usage(c.errOut)
+		return exitUsage
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		if len(args) < 2 {
+			c.usage(c.out)
+			return exitOK
+		}
+		cmd := findCommand(args[1])
+		if cmd == nil {
+			fmt.Fprintf(c.errOut, "Unknown command: %s\n", args[1])
+			return exitUsage
+		}
+		flags, _, _ := c.flagsFor(cmd)
+		flags.SetOutput(c.out)
+		printCommandHelp(c.out, cmd, flags)
+		return exitOK
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(c.errOut, "Unknown command: %s\n\n", args[0])
+		c.usage(c.errOut)
+		return exitUsage
+	}
+	if args[0] != cmd.name {
+		fmt.Fprintf(c.errOut, "greyhound %s is deprecated, use greyhound %s instead.\n", args[0], cmd.name)
+	}
+	flags, fn, env := c.flagsFor(cmd)
+	if err := flags.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if !cmd.boards {
+		return c.exitCode(cmd, fn(&commandRun{cli: c}, flags.Args()))
+	}
+	cfg, err := LoadConfig(flags, c.getenv, c.appFs)
+	if err != nil {
+		fmt.Fprintf(c.errOut, "greyhound %s: Invalid configuration: %v\n", cmd.name, err)
+		return exitUsage
+	}
+
+	audit, closeAudit, err := c.openAuditLog(cfg)
+	if err != nil {
+		fmt.Fprintf(c.errOut, "greyhound %s: %v\n", cmd.name, err)
+		return exitUsage
+	}
+	defer closeAudit()
+
+	// Every target is run in turn, stopping at the first one that fails. Differences found in
+	// one target don't stop the rest from being checked.
+	code := exitOK
+	for _, target := range cfg.Targets {
+		targetCode := c.forTarget(target).runTarget(cmd, fn, cfg, target, audit, firstSet(*env, target.Env), flags.Args())
+		if targetCode != exitOK {
+			code = targetCode
+		}
+		if targetCode != exitOK && targetCode != exitDifferences {
+			break
+		}
+	}
+	return code
+}
+
+// openAuditLog opens the audit log of a run, if there is one. The function returned closes it.
+func (c *cli) openAuditLog(cfg *Config) (*auditLog, func(), error) {
+	if cfg.AuditLog == "" && !cfg.Debug {
+		return nil, func() {}, nil
+	}
+	if cfg.AuditLog == "" || cfg.AuditLog == "-" {
+		return newAuditLog(c.errOut, cfg.Debug), func() {}, nil
+	}
+	file, err := c.appFs.OpenFile(cfg.AuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to open audit log: %v", err)
+	}
+	return newAuditLog(file, cfg.Debug), func() { file.Close() }, nil
+}
+
+// forTarget returns a cli whose output is labelled with the name of a target. The target with
+// no name isn't labelled.
+func (c *cli) forTarget(target *Target) *cli {
+	if target.Name == "" {
+		return c
+	}
+	labelled := *c
+	labelled.out = &prefixWriter{w: c.out, prefix: "[" + target.Name + "] "}
+	labelled.errOut = &prefixWriter{w: c.errOut, prefix: "[" + target.Name + "] "}
+	return &labelled
+}
+
+// runTarget runs a command against a single target, returning the code it exited with.
+func (c *cli) runTarget(cmd *command, fn runFunc, cfg *Config, target *Target, audit *auditLog, env string, args []string) int {
+	run := &commandRun{cli: c, cfg: cfg, target: target, audit: audit}
+	code, err := run.loadBoards(env)
+	defer func() {
+		for _, managed := range run.boards {
+			managed.fs.Close()
+		}
+	}()
+	if err != nil {
+		fmt.Fprintf(c.errOut, "greyhound %s: %v\n", cmd.name, err)
+		return code
+	}
+	return c.exitCode(cmd, fn(run, args))
+}
+
+// loadBoards loads the boards of every kind the target of a run processes, with the overlay of
+// an env. The code to exit with is returned alongside any error.
+func (run *commandRun) loadBoards(env string) (int, error) {
+	for _, kind := range run.target.Kinds {
+		board := run.target.Boards[kind.Name]
+		fs, err := CreateFileSystem(board.Path, board.Cache, run.appFs)
+		if err != nil {
+			return exitFailure, fmt.Errorf("Failed to Create FileSystem for %s boards: %v", kind.Name, err)
+		}
+		run.boards = append(run.boards, managedBoards{kind, fs})
+	}
+	if env != "" {
+		if err := selectEnv(run.boards, env); err != nil {
+			return exitUsage, err
+		}
+	}
+	return exitOK, nil
+}
+
+// prefixWriter starts every line written through it with a prefix.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	// midLine is set when the last write didn't end a line.
+	midLine bool
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if !pw.midLine {
+			if _, err := io.WriteString(pw.w, pw.prefix); err != nil {
+				return written, err
+			}
+			pw.midLine = true
+		}
+		line := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			line = p[:i+1]
+			pw.midLine = false
+		}
+		n, err := pw.w.Write(line)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(line):]
+	}
+	return written, nil
+}
+
+// exitCode reports the error a command returned, and picks the code to exit with for it.
+func (c *cli) exitCode(cmd *command, err error) int {
+	switch typed := err.(type) {
+	case nil:
+		return exitOK
+	case *usageError:
+		fmt.Fprintf(c.errOut, "greyhound %s: %v\n", cmd.name, typed)
+		fmt.Fprintf(c.errOut, "Run \"greyhound help %s\" for usage.\n", cmd.name)
+		return exitUsage
+	}
+	if err == errDifferences {
+		return exitDifferences
+	}
+	fmt.Fprintf(c.errOut, "greyhound %s: %v\n", cmd.name, err)
+	return exitFailure
+}
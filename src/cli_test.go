@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+// runTestCLI runs greyhound with args against screenboards holding the given files, returning
+// the exit code, and what was written to stdout, and stderr.
+func runTestCLI(t *testing.T, files map[string]string, args ...string) (int, string, string) {
+	dir, err := ioutil.TempDir("", "leveldb-cache-test-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	appFs := afero.NewMemMapFs()
+	appFs.MkdirAll("screens", 0755)
+	for name, contents := range files {
+		afero.WriteFile(appFs, "screens/"+name, []byte(contents), 0644)
+	}
+	env := map[string]string{"GREYDOG_SCREEN_PATH": "screens", "GREYDOG_CACHE_DIR": dir}
+	var out, errOut bytes.Buffer
+	c := &cli{appFs: appFs, getenv: func(key string) string { return env[key] }, out: &out, errOut: &errOut}
+	code := c.run(args)
+	return code, out.String(), errOut.String()
+}
+
+func TestCLI(t *testing.T) {
+	good := map[string]string{"good.yml": "---\nboard_title: Screen\nwidgets: []\n"}
+
+	cases := []struct {
+		name     string
+		files    map[string]string
+		args     []string
+		code     int
+		expected string
+	}{
+		{"No Command", good, nil, exitUsage, "Usage: greyhound <command>"},
+		{"Unknown Command", good, []string{"sync"}, exitUsage, "Unknown command: sync"},
+		{"Help", good, []string{"help"}, exitOK, "Commands:"},
+		{"Command Help", good, []string{"help", "plan"}, exitOK, "-detailed-exitcode"},
+		{"Command Help Flag", good, []string{"plan", "-h"}, exitOK, "Usage: greyhound plan"},
+		{"Unknown Flag", good, []string{"plan", "--nope"}, exitUsage, "flag provided but not defined: -nope"},
+		{"Unexpected Arguments", good, []string{"validate", "extra"}, exitUsage, "Unexpected arguments: extra"},
+		{"Misconfigured", good, []string{"validate", "--kinds", "timeboard"}, exitUsage, "Invalid configuration"},
+		{"Unknown Env", good, []string{"validate", "--env", "nope"}, exitUsage, `No overlay found for env "nope"`},
+		{"Version", good, []string{"version"}, exitOK, "greyhound dev"},
+		{"Validate", good, []string{"validate"}, exitOK, "Successful!"},
+		{"Validate Problems", map[string]string{"bad.yml": "---\nwidgets: []\n"}, []string{"validate"}, exitFailure, "Found 1 problems"},
+		{"Render", good, []string{"render", "screens/good.yml"}, exitOK, `"board_title": "Screen"`},
+		{"Cache List", good, []string{"cache", "list"}, exitOK, "KIND"},
+		{"State Alias", good, []string{"state", "list"}, exitOK, "greyhound state is deprecated, use greyhound cache instead."},
+		{"Unknown Cache Command", good, []string{"cache", "clear"}, exitUsage, "Unknown cache command: clear"},
+		{"Missing Keys", good, []string{"plan"}, exitUsage, "DATADOG_API_KEY, and DATADOG_APP_KEY must both be set"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			code, out, errOut := runTestCLI(t, c.files, c.args...)
+			if code != c.code {
+				t.Fatalf("Expected exit code %d, got %d: [ %s%s ]", c.code, code, out, errOut)
+			}
+			if !strings.Contains(out+errOut, c.expected) {
+				t.Fatalf("Expected output containing %q: [ %s%s ]", c.expected, out, errOut)
+			}
+		})
+	}
+}
+
+func TestCLITargets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leveldb-cache-test-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	appFs := afero.NewMemMapFs()
+	afero.WriteFile(appFs, "screens/good.yml", []byte("---\nboard_title: Screen\nwidgets: []\n"), 0644)
+	afero.WriteFile(appFs, "greyhound.yml", []byte("cache_dir: "+dir+"\nboards:\n  screen:\n    path: screens\ntargets:\n  prod: {}\n  staging: {}\n"), 0644)
+	var out, errOut bytes.Buffer
+	c := &cli{appFs: appFs, getenv: func(string) string { return "" }, out: &out, errOut: &errOut}
+
+	if code := c.run([]string{"validate"}); code != exitOK {
+		t.Fatalf("Validate failed: [ %s%s ]", out.String(), errOut.String())
+	}
+	if out.String() != "[prod] Successful!\n[staging] Successful!\n" {
+		t.Fatalf("Output wasn't labelled by target: [ %s ]", out.String())
+	}
+
+	out.Reset()
+	if code := c.run([]string{"render", "--targets", "prod", "screens/good.yml"}); code != exitOK {
+		t.Fatalf("Render failed: [ %s%s ]", out.String(), errOut.String())
+	}
+	var rendered map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &rendered); err != nil || rendered["board_title"] != "Screen" {
+		t.Fatalf("Rendered body can't be parsed as JSON: [ %s, %+v ]", out.String(), err)
+	}
+	if errOut.String() != "[prod] # screen screens/good.yml\n" {
+		t.Fatalf("Rendered board wasn't named on stderr: [ %s ]", errOut.String())
+	}
+
+	out.Reset()
+	errOut.Reset()
+	if code := c.run([]string{"plan", "--targets", "staging"}); code != exitUsage {
+		t.Fatalf("Plan without keys didn't fail: [ %s%s ]", out.String(), errOut.String())
+	}
+	if !strings.Contains(errOut.String(), "[staging] greyhound plan: DATADOG_API_KEY_STAGING, and DATADOG_APP_KEY_STAGING must both be set") {
+		t.Fatalf("Error wasn't labelled by target: [ %s ]", errOut.String())
+	}
+}
+
+func TestCLIReport(t *testing.T) {
+	defer gock.Off()
+	gock.New(testDatadogHost()).
+		Get("/api/v1/validate$").
+		Reply(200).
+		JSON(map[string]interface{}{"valid": true})
+	gock.New(testDatadogHost()).
+		Get("/api/v1/screen$").
+		Reply(200).
+		JSON(map[string]interface{}{"screenboards": []interface{}{}})
+	gock.New(testDatadogHost()).
+		Post("/api/v1/screen$").
+		Reply(200).
+		JSON(map[string]interface{}{"id": 42})
+
+	dir, err := ioutil.TempDir("", "leveldb-cache-test-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	appFs := afero.NewMemMapFs()
+	afero.WriteFile(appFs, "screens/good.yml", []byte("---\nboard_title: Screen\nwidgets: []\n"), 0644)
+	afero.WriteFile(appFs, "screens/bad.yml", []byte("---\nwidgets: []\n"), 0644)
+	env := map[string]string{
+		"GREYDOG_SCREEN_PATH": "screens",
+		"GREYDOG_CACHE_DIR":   dir,
+		"DATADOG_API_KEY":     "test",
+		"DATADOG_APP_KEY":     "test",
+	}
+	var out, errOut bytes.Buffer
+	c := &cli{appFs: appFs, getenv: func(key string) string { return env[key] }, out: &out, errOut: &errOut}
+
+	if code := c.run([]string{"apply", "--keep-going", "--report", "out/report.json"}); code != exitFailure {
+		t.Fatalf("Apply with a bad board didn't fail: [ %s%s ]", out.String(), errOut.String())
+	}
+	data, err := afero.ReadFile(appFs, "out/report.json")
+	if err != nil {
+		t.Fatalf("Report wasn't written: [ %+v ]", err)
+	}
+	var report Report
+	if err = json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Report isn't JSON: [ %s ]", data)
+	}
+	if len(report.Results) != 2 {
+		t.Fatalf("Expected a result per board: [ %s ]", data)
+	}
+	created, failed := report.Results[0], report.Results[1]
+	if created.File != "screens/good.yml" || created.Action != ResultCreated || created.ID != "42" || created.URL != "https://app.datadoghq.com/screen/42" {
+		t.Fatalf("Created board wasn't reported: [ %+v ]", created)
+	}
+	if failed.File != "screens/bad.yml" || failed.Action != ResultFailed || !strings.Contains(failed.Error, "has no board_title") {
+		t.Fatalf("Failed board wasn't reported: [ %+v ]", failed)
+	}
+
+	if code := c.run([]string{"apply", "--report", "report.xml", "--report-format", "html"}); code != exitUsage {
+		t.Fatalf("Unknown report format wasn't a usage error: [ %s ]", errOut.String())
+	}
+}
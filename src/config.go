@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+const (
+	// defaultConfigFile is the project config read when --config isn't given.
+	defaultConfigFile = "greyhound.yml"
+	// defaultSite is the Datadog site used when none is configured.
+	defaultSite = SiteUS1
+	// defaultCacheDir holds the cache of every kind of board that doesn't set its own.
+	defaultCacheDir = ".greyhound-cache"
+)
+
+// configuredKinds is every kind of board that can be configured, in the order they're processed.
+var configuredKinds = []BoardKind{DashKind, ScreenKind, DashboardKind}
+
+// BoardConfig is where the YAML, and cache of a kind of board live.
+type BoardConfig struct {
+	// The directory of YAML for the kind.
+	Path string `yaml:"path"`
+	// The directory of the cache for the kind, <cache dir>/<kind> if empty.
+	Cache string `yaml:"cache"`
+}
+
+// fileConfig is greyhound.yml, exactly as written.
+type fileConfig struct {
+	Site         string                 `yaml:"site"`
+	Host         string                 `yaml:"host"`
+	Timeout      string                 `yaml:"timeout"`
+	RetryTimeout string                 `yaml:"retry_timeout"`
+	Concurrency  *int                   `yaml:"concurrency"`
+	CacheDir     string                 `yaml:"cache_dir"`
+	Kinds        []string               `yaml:"kinds"`
+	Boards       map[string]BoardConfig `yaml:"boards"`
+	Targets      map[string]fileTarget  `yaml:"targets"`
+	Proxy        string                 `yaml:"proxy"`
+	CABundle     string                 `yaml:"ca_bundle"`
+	ClientCert   string                 `yaml:"client_cert"`
+	ClientKey    string                 `yaml:"client_key"`
+	AuditLog     string                 `yaml:"audit_log"`
+}
+
+// fileTarget is a target in greyhound.yml, exactly as written. Anything it doesn't set is taken
+// from the top level of greyhound.yml.
+type fileTarget struct {
+	Site      string                 `yaml:"site"`
+	Host      string                 `yaml:"host"`
+	APIKeyEnv string                 `yaml:"api_key_env"`
+	AppKeyEnv string                 `yaml:"app_key_env"`
+	Env       string                 `yaml:"env"`
+	Kinds     []string               `yaml:"kinds"`
+	Boards    map[string]BoardConfig `yaml:"boards"`
+}
+
+// Config is how Greyhound is configured for a run, merged together from flags, the environment,
+// greyhound.yml, and defaults, in that order of precedence.
+type Config struct {
+	// How long a single request may take.
+	Timeout time.Duration
+	// How long a request may be retried for in total.
+	RetryTimeout time.Duration
+	// How many boards are written to Datadog at once.
+	Concurrency int
+	// The directory kinds of boards keep their cache under, unless they set their own.
+	CacheDir string
+	// The Datadog orgs to sync boards to, in the order they're synced.
+	Targets []*Target
+	// How requests reach Datadog, shared by every target.
+	Transport TransportOptions
+	// The file every request to Datadog is logged to, - for stderr.
+	AuditLog string
+	// Debug logs the body of every request, and response too, to stderr if there's no AuditLog.
+	Debug bool
+}
+
+// Target is a Datadog org, and the boards synced to it. When greyhound.yml doesn't define any
+// targets, there's a single target with no name.
+type Target struct {
+	Name string
+	// The keys used to talk to the org. These only ever come from the environment, so they're
+	// never committed to a config file, or shown in the process list.
+	APIKey string
+	AppKey string
+	// The environment variables the keys are read from.
+	apiKeyEnv string
+	appKeyEnv string
+	// The Datadog site of the org.
+	Site Site
+	// A custom base URL for the API that wins over the site, e.g. for a proxy, or a fake.
+	Host string
+	// The overlay applied to the target's boards, if any.
+	Env string
+	// The kinds of board to process.
+	Kinds []BoardKind
+	// Where each kind of board lives, by the name of the kind.
+	Boards map[string]BoardConfig
+}
+
+// configSetting is a single setting, and every place it can be set from.
+type configSetting struct {
+	// The name of the flag.
+	flag string
+	// The environment variable.
+	env string
+	// Describes the setting for flag help, and errors.
+	usage string
+}
+
+var (
+	siteSetting         = configSetting{"site", "DATADOG_SITE", "The Datadog site of the org, e.g. datadoghq.eu, or us3.datadoghq.com."}
+	hostSetting         = configSetting{"host", "DATADOG_HOST", "A custom base URL for the Datadog API, e.g. for a proxy. Wins over the site."}
+	timeoutSetting      = configSetting{"timeout", "GREYDOG_TIMEOUT", "How long a single request to Datadog may take, e.g. 10s."}
+	retryTimeoutSetting = configSetting{"retry-timeout", "GREYDOG_RETRY_TIMEOUT", "How long a request to Datadog may be retried for, e.g. 50s."}
+	concurrencySetting  = configSetting{"concurrency", "GREYDOG_CONCURRENCY", "How many boards to write to Datadog at once."}
+	cacheDirSetting     = configSetting{"cache-dir", "GREYDOG_CACHE_DIR", "The directory caches are kept under."}
+	kindsSetting        = configSetting{"kinds", "GREYDOG_KINDS", "The kinds of board to process, e.g. dash,screen."}
+	configSettingFile   = configSetting{"config", "GREYDOG_CONFIG", "The project config to read."}
+	proxySetting        = configSetting{"proxy", "GREYDOG_PROXY", "The proxy to send requests through, HTTPS_PROXY is used when it isn't set."}
+	caBundleSetting     = configSetting{"ca-bundle", "GREYDOG_CA_BUNDLE", "A PEM file of certificates to trust on top of the system's."}
+	clientCertSetting   = configSetting{"client-cert", "GREYDOG_CLIENT_CERT", "A PEM client certificate to present to Datadog, or a proxy."}
+	clientKeySetting    = configSetting{"client-key", "GREYDOG_CLIENT_KEY", "The PEM key of the client certificate."}
+	auditLogSetting     = configSetting{"audit-log", "GREYDOG_AUDIT_LOG", "A file to log every request to Datadog to as JSON lines, - for stderr."}
+	debugSetting        = configSetting{"debug", "GREYDOG_DEBUG", "Log the body of every request, and response too, to stderr unless --audit-log is set."}
+	targetsSetting      = configSetting{"targets", "GREYDOG_TARGETS", "The targets to sync, e.g. prod,staging. Defaults to every target."}
+)
+
+// targetName is what a target may be called. Names are used in directories, and environment
+// variables, so they're kept simple.
+var targetName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// pathSetting is the setting for the directory of a kind of board.
+func pathSetting(kind BoardKind) configSetting {
+	return configSetting{
+		kind.Name + "-path",
+		"GREYDOG_" + strings.ToUpper(kind.Name) + "_PATH",
+		fmt.Sprintf("The directory of %s YAML.", kind.Name),
+	}
+}
+
+// cacheSetting is the setting for the cache directory of a kind of board.
+func cacheSetting(kind BoardKind) configSetting {
+	return configSetting{
+		kind.Name + "-cache",
+		"GREYDOG_CACHE_" + strings.ToUpper(kind.Name) + "_PATH",
+		fmt.Sprintf("The directory of the %s cache.", kind.Name),
+	}
+}
+
+// describe names every place a setting can come from, for errors.
+func (setting configSetting) describe(fileKey string) string {
+	return fmt.Sprintf("--%s, %s, or %s in %s", setting.flag, setting.env, fileKey, defaultConfigFile)
+}
+
+// registerConfigFlags adds the flag of every setting to a FlagSet. Flags are all strings, so
+// a flag that wasn't given can be told apart from one set to its zero value.
+func registerConfigFlags(flags *flag.FlagSet) {
+	settings := []configSetting{configSettingFile, targetsSetting, siteSetting, hostSetting, timeoutSetting, retryTimeoutSetting, concurrencySetting, cacheDirSetting, kindsSetting, proxySetting, caBundleSetting, clientCertSetting, clientKeySetting, auditLogSetting}
+	for _, kind := range configuredKinds {
+		settings = append(settings, pathSetting(kind), cacheSetting(kind))
+	}
+	for _, setting := range settings {
+		flags.String(setting.flag, "", fmt.Sprintf("%s (env: %s)", setting.usage, setting.env))
+	}
+	flags.Bool(debugSetting.flag, false, fmt.Sprintf("%s (env: %s)", debugSetting.usage, debugSetting.env))
+}
+
+// configSource looks settings up from the flags that were given, and the environment.
+type configSource struct {
+	flags  map[string]string
+	getenv func(string) string
+}
+
+// lookup finds a setting from a flag, or the environment, in that order. The empty string
+// means it wasn't set by either.
+func (source configSource) lookup(setting configSetting) string {
+	if value, ok := source.flags[setting.flag]; ok {
+		return value
+	}
+	return source.getenv(setting.env)
+}
+
+// LoadConfig builds the Config for a run from the flags that were given, the environment,
+// greyhound.yml, and defaults, in that order of precedence. Settings that don't make sense,
+// like a board directory that doesn't exist, are reported as errors rather than guessed at.
+func LoadConfig(flags *flag.FlagSet, getenv func(string) string, appFs afero.Fs) (*Config, error) {
+	source := configSource{make(map[string]string), getenv}
+	flags.Visit(func(f *flag.Flag) {
+		source.flags[f.Name] = f.Value.String()
+	})
+
+	file, err := readConfigFile(source, appFs)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if cfg.Timeout, err = parseDuration(timeoutSetting, "timeout", firstSet(source.lookup(timeoutSetting), file.Timeout, "10s")); err != nil {
+		return nil, err
+	}
+	if cfg.RetryTimeout, err = parseDuration(retryTimeoutSetting, "retry_timeout", firstSet(source.lookup(retryTimeoutSetting), file.RetryTimeout, (5*cfg.Timeout).String())); err != nil {
+		return nil, err
+	}
+
+	concurrency := source.lookup(concurrencySetting)
+	if concurrency == "" && file.Concurrency != nil {
+		concurrency = strconv.Itoa(*file.Concurrency)
+	}
+	if cfg.Concurrency, err = strconv.Atoi(firstSet(concurrency, "4")); err != nil || cfg.Concurrency < 1 {
+		return nil, fmt.Errorf("Concurrency %q must be a whole number of at least 1 (set by %s)", concurrency, concurrencySetting.describe("concurrency"))
+	}
+	cfg.CacheDir = firstSet(source.lookup(cacheDirSetting), file.CacheDir, defaultCacheDir)
+
+	cfg.Transport = TransportOptions{
+		Proxy:      firstSet(source.lookup(proxySetting), file.Proxy),
+		CABundle:   firstSet(source.lookup(caBundleSetting), file.CABundle),
+		ClientCert: firstSet(source.lookup(clientCertSetting), file.ClientCert),
+		ClientKey:  firstSet(source.lookup(clientKeySetting), file.ClientKey),
+	}
+	cfg.AuditLog = firstSet(source.lookup(auditLogSetting), file.AuditLog)
+	if debug := source.lookup(debugSetting); debug != "" {
+		if cfg.Debug, err = strconv.ParseBool(debug); err != nil {
+			return nil, fmt.Errorf("Debug %q must be true, or false (set by --%s, or %s)", debug, debugSetting.flag, debugSetting.env)
+		}
+	}
+
+	// Building the transport up front means a bad certificate is caught before anything runs.
+	if _, err = cfg.Transport.Transport(); err != nil {
+		return nil, err
+	}
+
+	names, err := selectTargets(source, file)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		target, err := loadTarget(source, file, name, cfg.CacheDir, appFs)
+		if err != nil {
+			if name != "" {
+				return nil, fmt.Errorf("Target %s: %v", name, err)
+			}
+			return nil, err
+		}
+		cfg.Targets = append(cfg.Targets, target)
+	}
+	return cfg, nil
+}
+
+// selectTargets picks the names of the targets to sync, every target in greyhound.yml unless
+// some are asked for by name. Without any targets in greyhound.yml there's a single target
+// with no name.
+func selectTargets(source configSource, file *fileConfig) ([]string, error) {
+	defined := []string{}
+	for name := range file.Targets {
+		defined = append(defined, name)
+	}
+	sort.Strings(defined)
+
+	asked := source.lookup(targetsSetting)
+	if len(defined) == 0 {
+		if asked != "" {
+			return nil, fmt.Errorf("Targets %q were asked for (set by %s), but %s doesn't define any", asked, targetsSetting.describe("targets"), defaultConfigFile)
+		}
+		return []string{""}, nil
+	}
+	if asked == "" {
+		return defined, nil
+	}
+
+	names := []string{}
+	for _, name := range strings.Split(asked, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := file.Targets[name]; !ok {
+			return nil, fmt.Errorf("Unknown target %q (set by %s), expected one of: %s", name, targetsSetting.describe("targets"), strings.Join(defined, ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// loadTarget builds a single target. Flags, and the environment win over the target's own
+// settings, which win over the top level of greyhound.yml. The caches of a named target are
+// always kept apart from every other target's, so their state never mixes.
+func loadTarget(source configSource, file *fileConfig, name string, cacheDir string, appFs afero.Fs) (*Target, error) {
+	fromTarget := file.Targets[name]
+	target := &Target{
+		Name:      name,
+		apiKeyEnv: "DATADOG_API_KEY",
+		appKeyEnv: "DATADOG_APP_KEY",
+		Env:       fromTarget.Env,
+		Boards:    make(map[string]BoardConfig),
+	}
+	if name != "" {
+		suffix := "_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+		target.apiKeyEnv = firstSet(fromTarget.APIKeyEnv, target.apiKeyEnv+suffix)
+		target.appKeyEnv = firstSet(fromTarget.AppKeyEnv, target.appKeyEnv+suffix)
+	}
+	target.APIKey = source.getenv(target.apiKeyEnv)
+	target.AppKey = source.getenv(target.appKeyEnv)
+
+	site, err := ParseSite(firstSet(source.lookup(siteSetting), fromTarget.Site, file.Site, string(defaultSite)))
+	if err != nil {
+		return nil, fmt.Errorf("%v (set by %s)", err, siteSetting.describe("site"))
+	}
+	target.Site = site
+	target.Host = firstSet(source.lookup(hostSetting), fromTarget.Host, file.Host)
+	if target.Host != "" && !strings.HasPrefix(target.Host, "http://") && !strings.HasPrefix(target.Host, "https://") {
+		return nil, fmt.Errorf("Host %q must start with http:// or https:// (set by %s)", target.Host, hostSetting.describe("host"))
+	}
+	target.Host = strings.TrimSuffix(target.Host, "/")
+
+	for _, kind := range configuredKinds {
+		board := BoardConfig{
+			Path:  firstSet(source.lookup(pathSetting(kind)), fromTarget.Boards[kind.Name].Path, file.Boards[kind.Name].Path),
+			Cache: firstSet(source.lookup(cacheSetting(kind)), file.Boards[kind.Name].Cache, strings.TrimSuffix(cacheDir, "/")+"/"+kind.Name),
+		}
+		if name != "" {
+			board.Cache = strings.TrimSuffix(board.Cache, "/") + "/" + name
+			if source.lookup(cacheSetting(kind)) == "" {
+				board.Cache = firstSet(fromTarget.Boards[kind.Name].Cache, board.Cache)
+			}
+		}
+		if board.Path == "" {
+			board.Cache = ""
+		}
+		target.Boards[kind.Name] = board
+	}
+
+	kinds := fromTarget.Kinds
+	if len(kinds) == 0 {
+		kinds = file.Kinds
+	}
+	if target.Kinds, err = selectKinds(source, kinds, target.Boards); err != nil {
+		return nil, err
+	}
+	for _, kind := range target.Kinds {
+		if err = checkBoardDir(appFs, kind, target.Boards[kind.Name].Path); err != nil {
+			return nil, err
+		}
+	}
+	return target, nil
+}
+
+// Connector creates a DatadogConnector for the site, and keys of a target.
+func (cfg *Config) Connector(target *Target) (*DatadogConnector, error) {
+	if target.APIKey == "" || target.AppKey == "" {
+		return nil, fmt.Errorf("%s, and %s must both be set to talk to Datadog", target.apiKeyEnv, target.appKeyEnv)
+	}
+	client := NewDatadogConnector(target.APIKey, target.AppKey, 0)
+	client.HTTPClient.Timeout = cfg.Timeout
+	client.RetryTimeout = cfg.RetryTimeout
+	client.Site = target.Site
+	client.BaseURL = target.Host
+	if err := client.SetTransport(cfg.Transport); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// readConfigFile reads greyhound.yml, or the file given by --config. The default file is
+// optional, but a file that was asked for by name must exist.
+func readConfigFile(source configSource, appFs afero.Fs) (*fileConfig, error) {
+	path := source.lookup(configSettingFile)
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigFile
+	}
+	data, err := afero.ReadFile(appFs, path)
+	if os.IsNotExist(err) && !explicit {
+		return &fileConfig{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read config %s: %v", path, err)
+	}
+
+	file := &fileConfig{}
+	decoder := yamlv3.NewDecoder(bytes.NewReader(data))
+	// A misspelt setting would otherwise be quietly ignored.
+	decoder.KnownFields(true)
+	if err = decoder.Decode(file); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Failed to parse config %s: %v", path, err)
+	}
+	if err = checkBoardKinds(file.Boards, "boards", path); err != nil {
+		return nil, err
+	}
+	for name, target := range file.Targets {
+		if !targetName.MatchString(name) {
+			return nil, fmt.Errorf("Target %q in %s may only use letters, numbers, - and _", name, path)
+		}
+		if err = checkBoardKinds(target.Boards, "targets."+name+".boards", path); err != nil {
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
+// checkBoardKinds makes sure every kind of board configured in a config file exists.
+func checkBoardKinds(boards map[string]BoardConfig, key string, path string) error {
+	for name := range boards {
+		if _, ok := kindNamed(name); !ok {
+			return fmt.Errorf("Unknown board kind %q under %s in %s, expected one of: %s", name, key, path, kindNames())
+		}
+	}
+	return nil
+}
+
+// selectKinds picks the kinds of board to process. Kinds that are asked for by name must have
+// a directory, otherwise every kind with a directory is processed.
+func selectKinds(source configSource, names []string, boards map[string]BoardConfig) ([]BoardKind, error) {
+	if fromSource := source.lookup(kindsSetting); fromSource != "" {
+		names = strings.Split(fromSource, ",")
+	}
+
+	kinds := []BoardKind{}
+	if len(names) == 0 {
+		for _, kind := range configuredKinds {
+			if boards[kind.Name].Path != "" {
+				kinds = append(kinds, kind)
+			}
+		}
+		if len(kinds) == 0 {
+			return nil, fmt.Errorf("No board directories are configured, set at least one of: %s", boardPathSettings())
+		}
+		return kinds, nil
+	}
+
+	for _, name := range names {
+		kind, ok := kindNamed(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("Unknown board kind %q (set by %s), expected one of: %s", name, kindsSetting.describe("kinds"), kindNames())
+		}
+		if boards[kind.Name].Path == "" {
+			return nil, fmt.Errorf("No directory is configured for %s boards, set it with %s", kind.Name, pathSetting(kind).describe("boards."+kind.Name+".path"))
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// checkBoardDir makes sure the directory of a kind of board exists. Walking an empty path
+// would otherwise quietly walk the current directory.
+func checkBoardDir(appFs afero.Fs, kind BoardKind, path string) error {
+	isDir, err := afero.DirExists(appFs, path)
+	if err != nil {
+		return err
+	}
+	if !isDir {
+		return fmt.Errorf("The %s directory %q doesn't exist (set by %s)", kind.Name, path, pathSetting(kind).describe("boards."+kind.Name+".path"))
+	}
+	return nil
+}
+
+// parseDuration parses a duration setting, which must be positive.
+func parseDuration(setting configSetting, fileKey string, value string) (time.Duration, error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("%q isn't a valid duration like 10s, or 1m30s (set by %s)", value, setting.describe(fileKey))
+	}
+	return duration, nil
+}
+
+// firstSet returns the first value that isn't empty.
+func firstSet(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// kindNamed finds the configurable BoardKind with a name.
+func kindNamed(name string) (BoardKind, bool) {
+	for _, kind := range configuredKinds {
+		if kind.Name == name {
+			return kind, true
+		}
+	}
+	return BoardKind{}, false
+}
+
+// kindNames lists the name of every configurable kind, for errors.
+func kindNames() string {
+	names := []string{}
+	for _, kind := range configuredKinds {
+		names = append(names, kind.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// boardPathSettings lists every setting for a board directory, for errors.
+func boardPathSettings() string {
+	settings := []string{}
+	for _, kind := range configuredKinds {
+		setting := pathSetting(kind)
+		settings = append(settings, fmt.Sprintf("--%s/%s", setting.flag, setting.env))
+	}
+	return strings.Join(settings, ", ") + ", or boards in " + defaultConfigFile
+}
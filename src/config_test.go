@@ -0,0 +1,219 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// loadTestConfig loads a Config from flags, an environment, and a greyhound.yml. An empty
+// file means there isn't one.
+func loadTestConfig(t *testing.T, args []string, env map[string]string, file string) (*Config, error) {
+	appFs := afero.NewMemMapFs()
+	for _, dir := range []string{"dashes", "screens", "other-dashes"} {
+		if err := appFs.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create test directory: [ %+v ]", err)
+		}
+	}
+	if file != "" {
+		if err := afero.WriteFile(appFs, defaultConfigFile, []byte(file), 0644); err != nil {
+			t.Fatalf("Failed to write test config: [ %+v ]", err)
+		}
+	}
+	flags := flag.NewFlagSet("greyhound", flag.ContinueOnError)
+	registerConfigFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		t.Fatalf("Failed to parse flags: [ %+v ]", err)
+	}
+	return LoadConfig(flags, func(key string) string { return env[key] }, appFs)
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		cfg, err := loadTestConfig(t, nil, map[string]string{"GREYDOG_DASH_PATH": "dashes"}, "")
+		if err != nil {
+			t.Fatalf("Failed to load config: [ %+v ]", err)
+		}
+		if len(cfg.Targets) != 1 || cfg.Targets[0].Name != "" {
+			t.Fatalf("Without targets there should be a single unnamed target: [ %+v ]", cfg.Targets)
+		}
+		if cfg.Targets[0].Site != SiteUS1 || cfg.Targets[0].Host != "" || cfg.Timeout != 10*time.Second || cfg.RetryTimeout != 50*time.Second || cfg.Concurrency != 4 {
+			t.Fatalf("Defaults weren't used: [ %+v ]", cfg)
+		}
+		if len(cfg.Targets[0].Kinds) != 1 || cfg.Targets[0].Kinds[0] != DashKind {
+			t.Fatalf("Only the kinds with a directory should be processed: [ %+v ]", cfg.Targets[0].Kinds)
+		}
+		if cfg.Targets[0].Boards["dash"].Cache != defaultCacheDir+"/dash" {
+			t.Fatalf("Cache wasn't put under the cache dir: [ %+v ]", cfg.Targets[0].Boards["dash"])
+		}
+	})
+
+	t.Run("Precedence", func(t *testing.T) {
+		file := `
+host: https://file.example.com
+timeout: 30s
+concurrency: 2
+cache_dir: file-cache
+boards:
+  dash:
+    path: other-dashes
+  screen:
+    path: screens
+    cache: screen-cache
+`
+		env := map[string]string{"DATADOG_HOST": "https://env.example.com", "GREYDOG_TIMEOUT": "20s", "GREYDOG_DASH_PATH": "dashes"}
+		cfg, err := loadTestConfig(t, []string{"--timeout", "5s"}, env, file)
+		if err != nil {
+			t.Fatalf("Failed to load config: [ %+v ]", err)
+		}
+		if cfg.Timeout != 5*time.Second {
+			t.Fatalf("Flag didn't win over env, and file: [ %v ]", cfg.Timeout)
+		}
+		if cfg.Targets[0].Host != "https://env.example.com" || cfg.Targets[0].Boards["dash"].Path != "dashes" {
+			t.Fatalf("Env didn't win over file: [ %+v ]", cfg.Targets[0])
+		}
+		if cfg.Concurrency != 2 || cfg.Targets[0].Boards["screen"].Cache != "screen-cache" || cfg.Targets[0].Boards["dash"].Cache != "file-cache/dash" {
+			t.Fatalf("File didn't win over defaults: [ %+v ]", cfg.Targets[0])
+		}
+		if cfg.RetryTimeout != 25*time.Second {
+			t.Fatalf("Retry timeout didn't default to 5 times the timeout: [ %v ]", cfg.RetryTimeout)
+		}
+	})
+
+	t.Run("Kinds", func(t *testing.T) {
+		env := map[string]string{"GREYDOG_DASH_PATH": "dashes", "GREYDOG_SCREEN_PATH": "screens"}
+		cfg, err := loadTestConfig(t, []string{"--kinds", "screen"}, env, "")
+		if err != nil {
+			t.Fatalf("Failed to load config: [ %+v ]", err)
+		}
+		if len(cfg.Targets[0].Kinds) != 1 || cfg.Targets[0].Kinds[0] != ScreenKind {
+			t.Fatalf("Only the kinds asked for should be processed: [ %+v ]", cfg.Targets[0].Kinds)
+		}
+	})
+
+	t.Run("Targets", func(t *testing.T) {
+		file := `
+host: https://app.datadoghq.com
+boards:
+  dash:
+    path: dashes
+targets:
+  prod:
+    env: prod
+  staging:
+    site: eu
+    host: https://staging.example.com
+    api_key_env: STAGING_KEY
+    boards:
+      dash:
+        path: other-dashes
+      screen:
+        path: screens
+`
+		env := map[string]string{"DATADOG_API_KEY_PROD": "prod-api", "DATADOG_APP_KEY_PROD": "prod-app", "STAGING_KEY": "staging-api"}
+		cfg, err := loadTestConfig(t, nil, env, file)
+		if err != nil {
+			t.Fatalf("Failed to load config: [ %+v ]", err)
+		}
+		if len(cfg.Targets) != 2 || cfg.Targets[0].Name != "prod" || cfg.Targets[1].Name != "staging" {
+			t.Fatalf("Every target should be loaded in order: [ %+v ]", cfg.Targets)
+		}
+		prod, staging := cfg.Targets[0], cfg.Targets[1]
+		if prod.APIKey != "prod-api" || prod.AppKey != "prod-app" || prod.Env != "prod" || prod.Host != "https://app.datadoghq.com" || prod.Site != SiteUS1 {
+			t.Fatalf("Target wasn't loaded: [ %+v ]", prod)
+		}
+		if prod.Boards["dash"].Path != "dashes" || len(prod.Kinds) != 1 {
+			t.Fatalf("Target didn't inherit the top level boards: [ %+v ]", prod)
+		}
+		if staging.APIKey != "staging-api" || staging.Site != SiteEU || staging.Host != "https://staging.example.com" || len(staging.Kinds) != 2 || staging.Boards["dash"].Path != "other-dashes" {
+			t.Fatalf("Target's own settings weren't used: [ %+v ]", staging)
+		}
+		if prod.Boards["dash"].Cache == staging.Boards["dash"].Cache {
+			t.Fatalf("Targets shouldn't share a cache: [ %s ]", prod.Boards["dash"].Cache)
+		}
+
+		cfg, err = loadTestConfig(t, []string{"--targets", "staging"}, env, file)
+		if err != nil {
+			t.Fatalf("Failed to load config: [ %+v ]", err)
+		}
+		if len(cfg.Targets) != 1 || cfg.Targets[0].Name != "staging" {
+			t.Fatalf("Only the targets asked for should be loaded: [ %+v ]", cfg.Targets)
+		}
+
+		if _, err = loadTestConfig(t, []string{"--targets", "qa"}, env, file); err == nil || !strings.Contains(err.Error(), `Unknown target "qa"`) {
+			t.Fatalf("Unknown target wasn't an error: [ %+v ]", err)
+		}
+		if _, err = loadTestConfig(t, nil, env, file+"  qa:\n    boards:\n      dash:\n        path: nope\n"); err == nil || !strings.Contains(err.Error(), "Target qa: The dash directory") {
+			t.Fatalf("Misconfigured target wasn't named in the error: [ %+v ]", err)
+		}
+	})
+
+	t.Run("Target Caches", func(t *testing.T) {
+		file := `
+boards:
+  dash:
+    path: dashes
+targets:
+  prod:
+    boards:
+      dash:
+        cache: prod-cache
+`
+		cfg, err := loadTestConfig(t, nil, nil, file)
+		if err != nil {
+			t.Fatalf("Failed to load config: [ %+v ]", err)
+		}
+		if cache := cfg.Targets[0].Boards["dash"].Cache; cache != "prod-cache" {
+			t.Fatalf("Target's own cache wasn't used: [ %s ]", cache)
+		}
+
+		cfg, err = loadTestConfig(t, []string{"--dash-cache", "flag-cache"}, nil, file)
+		if err != nil {
+			t.Fatalf("Failed to load config: [ %+v ]", err)
+		}
+		if cache := cfg.Targets[0].Boards["dash"].Cache; cache != "flag-cache/prod" {
+			t.Fatalf("Flag didn't win over the target's cache: [ %s ]", cache)
+		}
+
+		cfg, err = loadTestConfig(t, nil, map[string]string{"GREYDOG_CACHE_DASH_PATH": "env-cache"}, file)
+		if err != nil {
+			t.Fatalf("Failed to load config: [ %+v ]", err)
+		}
+		if cache := cfg.Targets[0].Boards["dash"].Cache; cache != "env-cache/prod" {
+			t.Fatalf("Env var didn't win over the target's cache: [ %s ]", cache)
+		}
+	})
+
+	t.Run("Misconfiguration", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			args     []string
+			env      map[string]string
+			file     string
+			expected string
+		}{
+			{"No Directories", nil, nil, "", "No board directories are configured"},
+			{"Empty Path", []string{"--kinds", "dash"}, nil, "", "No directory is configured for dash boards"},
+			{"Missing Directory", nil, map[string]string{"GREYDOG_DASH_PATH": "nope"}, "", `The dash directory "nope" doesn't exist`},
+			{"Unknown Kind", []string{"--kinds", "dash,timeboard"}, map[string]string{"GREYDOG_DASH_PATH": "dashes"}, "", `Unknown board kind "timeboard"`},
+			{"Bad Timeout", []string{"--timeout", "10"}, map[string]string{"GREYDOG_DASH_PATH": "dashes"}, "", `"10" isn't a valid duration`},
+			{"Bad Concurrency", nil, map[string]string{"GREYDOG_DASH_PATH": "dashes", "GREYDOG_CONCURRENCY": "0"}, "", "Concurrency \"0\" must be"},
+			{"Unknown Site", []string{"--site", "datadoghq.de"}, map[string]string{"GREYDOG_DASH_PATH": "dashes"}, "", `Unknown Datadog site "datadoghq.de"`},
+			{"Bad Host", []string{"--host", "app.datadoghq.com"}, map[string]string{"GREYDOG_DASH_PATH": "dashes"}, "", "must start with http"},
+			{"Unknown Setting", nil, nil, "concurency: 2\n", "field concurency not found"},
+			{"Missing Config", []string{"--config", "nope.yml"}, nil, "", "Failed to read config nope.yml"},
+			{"No Targets Defined", []string{"--targets", "prod"}, map[string]string{"GREYDOG_DASH_PATH": "dashes"}, "", "doesn't define any"},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				_, err := loadTestConfig(t, c.args, c.env, c.file)
+				if err == nil || !strings.Contains(err.Error(), c.expected) {
+					t.Fatalf("Expected an error containing %q: [ %+v ]", c.expected, err)
+				}
+			})
+		}
+	})
+}
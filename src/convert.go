@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// screenLayoutFields are the fields of a screenboard widget that place it on the board, which
+// live under layout in a dashboard.
+var screenLayoutFields = []string{"x", "y", "width", "height"}
+
+// legacyWidgetRenames are fields of screenboard widgets that were renamed in dashboards, by the
+// type of widget they're on.
+var legacyWidgetRenames = map[string]map[string]string{
+	"note":         {"html": "content", "bgcolor": "background_color", "tick": "show_tick"},
+	"event_stream": {"size": "event_size"},
+}
+
+// copyMap makes a shallow copy of a map, or an empty map if it isn't one.
+func copyMap(value interface{}) map[string]interface{} {
+	copied := make(map[string]interface{})
+	if in, ok := value.(map[string]interface{}); ok {
+		for k, v := range in {
+			copied[k] = v
+		}
+	}
+	return copied
+}
+
+// convertRequests converts the requests of a graph. Timeseries requests call how they're drawn
+// display_type, rather than type.
+func convertRequests(widgetType string, requests interface{}) interface{} {
+	list, ok := requests.([]interface{})
+	if !ok || widgetType != "timeseries" {
+		return requests
+	}
+	converted := make([]interface{}, 0, len(list))
+	for _, request := range list {
+		fields := copyMap(request)
+		if display, ok := fields["type"]; ok {
+			fields["display_type"] = display
+			delete(fields, "type")
+		}
+		converted = append(converted, fields)
+	}
+	return converted
+}
+
+// convertTimeboardGraph turns a graph of a timeboard into a dashboard widget.
+func convertTimeboardGraph(graph map[string]interface{}) map[string]interface{} {
+	definition := copyMap(graph["definition"])
+	widgetType, _ := definition["viz"].(string)
+	if widgetType == "" {
+		widgetType = "timeseries"
+	}
+	delete(definition, "viz")
+	definition["type"] = widgetType
+	if title, ok := graph["title"]; ok {
+		definition["title"] = title
+	}
+	if requests, ok := definition["requests"]; ok {
+		definition["requests"] = convertRequests(widgetType, requests)
+	}
+	return map[string]interface{}{"definition": definition}
+}
+
+// convertScreenWidget turns a widget of a screenboard into a dashboard widget. Where the widget
+// sits moves under layout, and everything describing it moves under definition.
+func convertScreenWidget(widget map[string]interface{}) map[string]interface{} {
+	fields := copyMap(widget)
+	widgetType, _ := fields["type"].(string)
+
+	layout := make(map[string]interface{})
+	for _, field := range screenLayoutFields {
+		if value, ok := fields[field]; ok {
+			layout[field] = value
+			delete(fields, field)
+		}
+	}
+
+	definition := copyMap(fields["tile_def"])
+	delete(definition, "viz")
+	delete(fields, "tile_def")
+	// title was a flag for showing title_text, a dashboard widget shows its title if it has one.
+	delete(fields, "title")
+	if title, ok := fields["title_text"]; ok {
+		definition["title"] = title
+		delete(fields, "title_text")
+	}
+	for k, v := range fields {
+		if renamed, ok := legacyWidgetRenames[widgetType][k]; ok {
+			k = renamed
+		}
+		definition[k] = v
+	}
+	if requests, ok := definition["requests"]; ok {
+		definition["requests"] = convertRequests(widgetType, requests)
+	}
+
+	converted := map[string]interface{}{"definition": definition}
+	if len(layout) > 0 {
+		converted["layout"] = layout
+	}
+	return converted
+}
+
+// ConvertBoard turns the payload of a timeboard, or screenboard into the payload of a dashboard
+// for the unified dashboard API. Timeboards become ordered dashboards, and screenboards become
+// free ones. Fields the converter doesn't know about are carried over as they are, so converted
+// boards should be checked with validate.
+func ConvertBoard(kind BoardKind, board map[string]interface{}) (map[string]interface{}, error) {
+	title, err := kind.Title(board)
+	if err != nil {
+		return nil, err
+	}
+	dashboard := map[string]interface{}{"title": title}
+	for _, field := range []string{"description", "template_variables"} {
+		if value, ok := board[field]; ok {
+			dashboard[field] = value
+		}
+	}
+	if readOnly, ok := board["read_only"]; ok {
+		dashboard["is_read_only"] = readOnly
+	}
+
+	widgets := []interface{}{}
+	switch kind {
+	case DashKind:
+		dashboard["layout_type"] = "ordered"
+		graphs, _ := board["graphs"].([]interface{})
+		for _, graph := range graphs {
+			widgets = append(widgets, convertTimeboardGraph(copyMap(graph)))
+		}
+	case ScreenKind:
+		dashboard["layout_type"] = "free"
+		screenWidgets, _ := board["widgets"].([]interface{})
+		for _, widget := range screenWidgets {
+			widgets = append(widgets, convertScreenWidget(copyMap(widget)))
+		}
+	default:
+		return nil, fmt.Errorf("Can't convert a %s into a dashboard", kind.Name)
+	}
+	dashboard["widgets"] = widgets
+	return dashboard, nil
+}
+
+// ConvertBoards converts every timeboard, or screenboard YAML file in from into a dashboard
+// YAML file in to, at the same path relative to the root (see convertedPath). Existing files are
+// never overwritten. converted holds the file every path was converted from, so boards converted
+// to the same path fail rather than overwriting each other, and may be shared across kinds. The
+// paths of the written files are returned.
+func ConvertBoards(kind BoardKind, from *FileSystem, to *FileSystem, converted map[string]string, opts SyncOptions) ([]string, error) {
+	if converted == nil {
+		converted = make(map[string]string)
+	}
+	collector := &errorCollector{keepGoing: opts.KeepGoing}
+	templates, err := from.GetTemplateFiles()
+	if err = collector.add(err); err != nil {
+		return nil, err
+	}
+	if err = to.appFs.MkdirAll(to.RootDir, 0755); err != nil {
+		return nil, err
+	}
+
+	written := []string{}
+	for _, template := range templates {
+		path, err := convertTemplate(kind, template, from, to, converted)
+		if err != nil {
+			if err = collector.addFile(template.Path, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if path != "" {
+			written = append(written, path)
+		}
+	}
+	return written, collector.result()
+}
+
+// convertedPath is where the template at path in from is converted to in to. The path relative
+// to the root is kept, and a board expanded from a file with many documents is named after both,
+// e.g. services.yml#api is converted to services-api.yml.
+func convertedPath(path string, from *FileSystem, to *FileSystem) (string, error) {
+	rel, err := filepath.Rel(filepath.Clean(from.RootDir), templateSource(path))
+	if err != nil {
+		return "", err
+	}
+	if source := templateSource(path); source != path {
+		rel = strings.TrimSuffix(rel, ".yml") + "-" + path[len(source)+1:] + ".yml"
+	}
+	return filepath.Join(to.RootDir, rel), nil
+}
+
+// convertTemplate converts a single template into a dashboard YAML file in to, returning the
+// path it was written to, and recording it in converted. An empty path means the template didn't
+// describe a board.
+func convertTemplate(kind BoardKind, template Template, from *FileSystem, to *FileSystem, converted map[string]string) (string, error) {
+	payload, err := kind.Payload(template.Contents)
+	if err != nil || payload == nil {
+		return "", err
+	}
+	dashboard, err := ConvertBoard(kind, payload)
+	if err != nil {
+		return "", err
+	}
+	path, err := convertedPath(template.Path, from, to)
+	if err != nil {
+		return "", err
+	}
+	if other, ok := converted[path]; ok {
+		return "", fmt.Errorf("%s would be converted to %s, which %s was already converted to", template.Path, path, other)
+	}
+	converted[path] = template.Path
+	exists, err := afero.Exists(to.appFs, path)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", fmt.Errorf("%s already exists", path)
+	}
+	data, err := boardToYAML(DashboardKind, dashboard)
+	if err != nil {
+		return "", err
+	}
+	if err = to.appFs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	return path, afero.WriteFile(to.appFs, path, data, 0644)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestConvertBoard(t *testing.T) {
+	t.Run("Timeboard Becomes Ordered", func(t *testing.T) {
+		converted, err := ConvertBoard(DashKind, map[string]interface{}{
+			"title":       "Service",
+			"description": "All about the service",
+			"read_only":   true,
+			"graphs": []interface{}{
+				map[string]interface{}{
+					"title": "CPU",
+					"definition": map[string]interface{}{
+						"viz":      "timeseries",
+						"requests": []interface{}{map[string]interface{}{"q": "avg:system.cpu.user{*}", "type": "line"}},
+					},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]interface{}{
+			"title":        "Service",
+			"description":  "All about the service",
+			"is_read_only": true,
+			"layout_type":  "ordered",
+			"widgets": []interface{}{
+				map[string]interface{}{
+					"definition": map[string]interface{}{
+						"type":     "timeseries",
+						"title":    "CPU",
+						"requests": []interface{}{map[string]interface{}{"q": "avg:system.cpu.user{*}", "display_type": "line"}},
+					},
+				},
+			},
+		}
+		if !reflect.DeepEqual(converted, expected) {
+			t.Fatalf("Timeboard wasn't converted correctly: [ %+v ]", converted)
+		}
+	})
+
+	t.Run("Screenboard Becomes Free", func(t *testing.T) {
+		converted, err := ConvertBoard(ScreenKind, map[string]interface{}{
+			"board_title": "Overview",
+			"widgets": []interface{}{
+				map[string]interface{}{
+					"type": "note", "html": "Hello", "bgcolor": "yellow",
+					"x": 1.0, "y": 2.0, "width": 10.0, "height": 5.0,
+				},
+				map[string]interface{}{
+					"type": "query_value", "title": true, "title_text": "Errors",
+					"x": 12.0, "y": 2.0, "width": 10.0, "height": 5.0,
+					"tile_def": map[string]interface{}{"viz": "query_value", "requests": []interface{}{}},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]interface{}{
+			"title":       "Overview",
+			"layout_type": "free",
+			"widgets": []interface{}{
+				map[string]interface{}{
+					"definition": map[string]interface{}{"type": "note", "content": "Hello", "background_color": "yellow"},
+					"layout":     map[string]interface{}{"x": 1.0, "y": 2.0, "width": 10.0, "height": 5.0},
+				},
+				map[string]interface{}{
+					"definition": map[string]interface{}{"type": "query_value", "title": "Errors", "requests": []interface{}{}},
+					"layout":     map[string]interface{}{"x": 12.0, "y": 2.0, "width": 10.0, "height": 5.0},
+				},
+			},
+		}
+		if !reflect.DeepEqual(converted, expected) {
+			t.Fatalf("Screenboard wasn't converted correctly: [ %+v ]", converted)
+		}
+	})
+}
+
+func TestConvertBoards(t *testing.T) {
+	from, cleanup := createTestFileSystem(t, map[string]string{
+		"service.yml": "---\ndash:\n  title: Service\n  description: svc\n  graphs: []\n",
+	})
+	defer cleanup()
+	to, cleanupTo := createTestFileSystem(t, map[string]string{})
+	defer cleanupTo()
+	to.RootDir = "src/dashboards/"
+
+	written, err := ConvertBoards(DashKind, from, to, nil, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 1 || written[0] != "src/dashboards/service.yml" {
+		t.Fatalf("Converted board was written to the wrong place: [ %+v ]", written)
+	}
+	data, err := afero.ReadFile(to.appFs, written[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := ValidateBoard(DashboardKind, written[0], data); len(errs) != 0 {
+		t.Fatalf("Converted board isn't a valid dashboard: [ %+v ]", errs)
+	}
+
+	t.Run("Existing Files Are Left Alone", func(t *testing.T) {
+		_, err := ConvertBoards(DashKind, from, to, nil, SyncOptions{})
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Fatalf("Converting over an existing file didn't fail: [ %+v ]", err)
+		}
+	})
+
+	t.Run("Paths Are Kept", func(t *testing.T) {
+		from, cleanup := createTestFileSystem(t, map[string]string{
+			"team/service.yml": "---\ndash:\n  title: Team Service\n  graphs: []\n",
+			"services.yml":     "---\ndash:\n  title: API\n  graphs: []\n---\ndash:\n  title: Web\n  graphs: []\n",
+		})
+		defer cleanup()
+		to, cleanupTo := createTestFileSystem(t, map[string]string{})
+		defer cleanupTo()
+		to.RootDir = "src/dashboards/"
+
+		written, err := ConvertBoards(DashKind, from, to, nil, SyncOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{"src/dashboards/services-api.yml", "src/dashboards/services-web.yml", "src/dashboards/team/service.yml"}
+		if !reflect.DeepEqual(written, expected) {
+			t.Fatalf("Converted boards were written to the wrong places: [ %+v ]", written)
+		}
+		to.RootDir = "src/dashboards"
+		templates, err := to.GetTemplateFiles()
+		if err != nil || len(templates) != 3 {
+			t.Fatalf("Converted boards can't all be loaded again: [ %+v, %+v ]", templates, err)
+		}
+	})
+
+	t.Run("Boards Converted To The Same File Fail", func(t *testing.T) {
+		from, cleanup := createTestFileSystem(t, map[string]string{
+			"services.yml":     "---\ndash:\n  title: API\n  graphs: []\n---\ndash:\n  title: Web\n  graphs: []\n",
+			"services-api.yml": "---\ndash:\n  title: Other API\n  graphs: []\n",
+		})
+		defer cleanup()
+		to, cleanupTo := createTestFileSystem(t, map[string]string{})
+		defer cleanupTo()
+		to.RootDir = "src/dashboards/"
+
+		_, err := ConvertBoards(DashKind, from, to, nil, SyncOptions{KeepGoing: true})
+		if err == nil || !strings.Contains(err.Error(), "src/dashboards/services-api.yml, which") {
+			t.Fatalf("Boards converted to the same file didn't fail: [ %+v ]", err)
+		}
+	})
+}
@@ -3,16 +3,15 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff"
-	"gopkg.in/yaml.v2"
 )
 
 // DatadogConnector performs a connection to Datadog.
@@ -25,6 +24,16 @@ type DatadogConnector struct {
 	HTTPClient *http.Client
 	// RetryTimeout specifies the retry timeout
 	RetryTimeout time.Duration
+	// Site is the Datadog site of the org, which decides where requests are sent.
+	Site Site
+	// BaseURL replaces the base URL of the Site when it's set, e.g. for a proxy, or a fake.
+	BaseURL string
+	// limiter paces requests so we stay under Datadog's rate limits.
+	limiter *rateLimiter
+	// audit logs every request, when it's set.
+	audit *auditLog
+	// file is the YAML file requests are being made for, for the audit log.
+	file string
 }
 
 type validationResponse struct {
@@ -46,11 +55,20 @@ type Screenboard struct {
 	Title *string `json:"title,omitempty"`
 }
 
-// CreateDashboardResp is a response from CreateDashboard
+// UnifiedDashboard NOTE this doesn't contain all fields for a dashboard, just the fields
+// We care about for HTTP.
+type UnifiedDashboard struct {
+	ID         *string `json:"id,omitempty"`
+	Title      *string `json:"title,omitempty"`
+	LayoutType *string `json:"layout_type,omitempty"`
+}
+
+// CreateDashboardResp is a response from writing a board. Only legacy dashes are wrapped in dash,
+// whose ID is a number when it's created.
 type CreateDashboardResp struct {
-	Resource  *string    `json:"resource,omitempty"`
-	URL       *string    `json:"url,omitempty"`
-	Dashboard *Dashboard `json:"dash,omitempty"`
+	Resource  *string                `json:"resource,omitempty"`
+	URL       *string                `json:"url,omitempty"`
+	Dashboard map[string]interface{} `json:"dash,omitempty"`
 }
 
 // DashboardListResp is a list of Dashboards.
@@ -58,6 +76,11 @@ type DashboardListResp struct {
 	Dashboards []Dashboard `json:"dashes,omitempty"`
 }
 
+// UnifiedDashboardListResp is a list of Dashboards from the unified dashboard API.
+type UnifiedDashboardListResp struct {
+	Dashboards []UnifiedDashboard `json:"dashboards,omitempty"`
+}
+
 // ScreensListResp is a list of Screenboards.
 type ScreensListResp struct {
 	Dashboards []Screenboard `json:"screenboards,omitempty"`
@@ -72,38 +95,69 @@ func NewDatadogConnector(apiKey string, appKey string, timeoutSeconds int) *Data
 			Timeout: time.Duration(timeoutSeconds) * time.Second,
 		},
 		time.Duration(timeoutSeconds*5) * time.Second,
+		SiteUS1,
+		"",
+		newRateLimiter(),
+		nil,
+		"",
 	}
 }
 
-// urlForApi grabs a url for a specific API Path.
+// urlForApi grabs a url for a specific API Path. The keys are sent as headers rather than in
+// the url, so the url is safe to log.
 func (client *DatadogConnector) uriForAPI(api string) string {
-	url := os.Getenv("DATADOG_HOST")
+	url := client.BaseURL
 	if url == "" {
-		url = "https://app.datadoghq.com"
+		url = client.Site.BaseURL()
+	}
+	return strings.TrimSuffix(url, "/") + "/api" + api
+}
+
+// newRequest builds a request for a specific API Path, authenticated with our keys.
+func (client *DatadogConnector) newRequest(method string, api string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, client.uriForAPI(api), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("DD-API-KEY", client.apiKey)
+	req.Header.Set("DD-APPLICATION-KEY", client.appKey)
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
 	}
-	if strings.Index(api, "?") > -1 {
-		return url + "/api" + api + "&api_key=" +
-			client.apiKey + "&application_key=" + client.appKey
+	return req, nil
+}
+
+// redact replaces our keys anywhere they show up in s, so they can't leak into errors, or logs.
+func (client *DatadogConnector) redact(s string) string {
+	for _, key := range []string{client.apiKey, client.appKey} {
+		if key != "" {
+			s = strings.Replace(s, key, "[REDACTED]", -1)
+		}
 	}
-	return url + "/api" + api + "?api_key=" +
-		client.apiKey + "&application_key=" + client.appKey
+	return s
+}
+
+// redactError makes sure an error doesn't mention our keys.
+func (client *DatadogConnector) redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if redacted := client.redact(err.Error()); redacted != err.Error() {
+		return errors.New(redacted)
+	}
+	return err
 }
 
 // Validate checks if the API and application keys are valid.
 func (client *DatadogConnector) Validate() (bool, error) {
-	var bodyreader io.Reader
 	var out validationResponse
-	req, err := http.NewRequest("GET", client.uriForAPI("/v1/validate"), bodyreader)
-
+	req, err := client.newRequest("GET", "/v1/validate", nil)
 	if err != nil {
 		return false, err
 	}
-	if bodyreader != nil {
-		req.Header.Add("Content-Type", "application/json")
-	}
 
 	var resp *http.Response
-	resp, err = client.HTTPClient.Do(req)
+	resp, err = client.doRequestWithRetries(req, client.RetryTimeout, true)
 	if err != nil {
 		return false, err
 	}
@@ -117,7 +171,7 @@ func (client *DatadogConnector) Validate() (bool, error) {
 		if err != nil {
 			return false, err
 		}
-		return false, fmt.Errorf("API error %s: %s", resp.Status, body)
+		return false, &APIError{"GET", "/v1/validate", resp.StatusCode, resp.Status, client.redact(string(body))}
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
@@ -129,14 +183,22 @@ func (client *DatadogConnector) Validate() (bool, error) {
 	return out.IsValid, nil
 }
 
-// doRequestWithRetries performs an HTTP request repeatedly for maxTime or until
-// no error and no acceptable HTTP response code was returned.
-func (client *DatadogConnector) doRequestWithRetries(req *http.Request, maxTime time.Duration) (*http.Response, error) {
+// doRequestWithRetries performs an HTTP request repeatedly for maxTime, or until it gets a
+// response that isn't worth retrying. Every attempt is paced by the rate limiter. A 429 means
+// Datadog turned the request away without acting on it, so it's always retried once the rate
+// limit resets, whatever the method. Network errors, and 5xx responses are only retried when
+// retryFailures is set, as the request may have been carried out. If the retries run out the
+// last response is returned, so the caller can report the status Datadog gave.
+func (client *DatadogConnector) doRequestWithRetries(req *http.Request, maxTime time.Duration, retryFailures bool) (*http.Response, error) {
 	var (
 		err  error
 		resp *http.Response
 		bo   = backoff.NewExponentialBackOff()
 		body []byte
+		// stopErr is a failure that mustn't be retried.
+		stopErr  error
+		attempts int
+		start    = time.Now()
 	)
 
 	bo.MaxElapsedTime = maxTime
@@ -150,21 +212,38 @@ func (client *DatadogConnector) doRequestWithRetries(req *http.Request, maxTime
 	}
 
 	operation := func() error {
+		// Only the last response is handed back, so throw away the one we're retrying.
+		if resp != nil {
+			resp.Body.Close()
+			resp = nil
+		}
 		if body != nil {
 			r := bytes.NewReader(body)
 			req.Body = ioutil.NopCloser(r)
 		}
 
+		client.limiter.wait(req.URL.Path)
+		attempts++
 		resp, err = client.HTTPClient.Do(req)
 		if err != nil {
+			resp = nil
+			if !retryFailures {
+				stopErr = err
+				return nil
+			}
 			return err
 		}
+		client.limiter.update(req.URL.Path, resp)
 
 		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 			// 2xx all done
 			return nil
+		} else if resp.StatusCode == http.StatusTooManyRequests {
+			return fmt.Errorf("Rate limited by Datadog")
 		} else if resp.StatusCode >= 400 && resp.StatusCode < 500 {
-			// 4xx are not retryable
+			// Other 4xx are not retryable
+			return nil
+		} else if !retryFailures {
 			return nil
 		}
 
@@ -172,37 +251,42 @@ func (client *DatadogConnector) doRequestWithRetries(req *http.Request, maxTime
 	}
 
 	err = backoff.Retry(operation, bo)
-
+	if stopErr != nil {
+		err = stopErr
+	}
+	if resp != nil {
+		err = nil
+	}
+	err = client.redactError(err)
+	client.logRequest(req, body, resp, attempts, start, err)
 	return resp, err
 }
 
+// requestBody encodes the body of a request, exactly as it's sent to Datadog.
+func requestBody(reqbody interface{}) ([]byte, error) {
+	return json.Marshal(reqbody)
+}
+
 // DoJSONRequest is the simplest type of request: a method on a URI that returns
 // some JSON result which we unmarshal into the passed interface.
 func (client *DatadogConnector) DoJSONRequest(method string, api string, reqbody, out interface{}) error {
 	var bodyreader io.Reader
 	if method != "GET" && reqbody != nil {
-		bjson, err := json.Marshal(reqbody)
+		bjson, err := requestBody(reqbody)
 		if err != nil {
 			return err
 		}
 		bodyreader = bytes.NewReader(bjson)
 	}
 
-	req, err := http.NewRequest(method, client.uriForAPI(api), bodyreader)
+	req, err := client.newRequest(method, api, bodyreader)
 	if err != nil {
 		return err
 	}
-	if bodyreader != nil {
-		req.Header.Add("Content-Type", "application/json")
-	}
 
-	// Perform the request and retry it if it's not a POST or PUT or DELETE request
-	var resp *http.Response
-	if method == "POST" || method == "PUT" || method == "DELETE" {
-		resp, err = client.HTTPClient.Do(req)
-	} else {
-		resp, err = client.doRequestWithRetries(req, client.RetryTimeout)
-	}
+	// Perform the request. Anything other than a GET may have been carried out when it fails, so
+	// those are only retried when Datadog rate limited them.
+	resp, err := client.doRequestWithRetries(req, client.RetryTimeout, method == "GET")
 	if err != nil {
 		return err
 	}
@@ -213,7 +297,7 @@ func (client *DatadogConnector) DoJSONRequest(method string, api string, reqbody
 		if err != nil {
 			return err
 		}
-		return fmt.Errorf("API error %s: %s", resp.Status, body)
+		return &APIError{method, api, resp.StatusCode, resp.Status, client.redact(string(body))}
 	}
 
 	// If they don't care about the body, then we don't care to give them one,
@@ -238,72 +322,39 @@ func (client *DatadogConnector) DoJSONRequest(method string, api string, reqbody
 	return nil
 }
 
-// DryRunDash creates, and destroys a whole bunch of example dashboards.
-func (client *DatadogConnector) DryRunDash(fs *FileSystem) error {
-	docs, err := fs.GetTemplates()
-	if err != nil {
+// dryRunBoards creates, and destroys an example board for every template of a kind, using
+// opts.Concurrency workers at once.
+func (client *DatadogConnector) dryRunBoards(kind BoardKind, fs *FileSystem, opts SyncOptions) error {
+	collector := &errorCollector{keepGoing: opts.KeepGoing}
+	templates, err := fs.GetTemplateFiles()
+	if err = collector.add(err); err != nil {
 		return err
 	}
-	for _, doc := range docs {
-		var out CreateDashboardResp
-		if err := client.DoJSONRequest("POST", "/v1/dash", doc, &out); err != nil {
-			return err
-		}
-		if out.Dashboard == nil || out.Dashboard.ID == nil {
-			return fmt.Errorf("Response from datadog had no valid dashboard: %+v", out)
+	errs := runPool(opts.Concurrency, len(templates), opts.KeepGoing, func(i int) error {
+		template := templates[i]
+		payload, err := kind.Payload(template.Contents)
+		if err != nil {
+			return &FileError{template.Path, err}
 		}
-		if err := client.DoJSONRequest("DELETE", fmt.Sprintf("/v1/dash/%s", *out.Dashboard.ID), nil, nil); err != nil {
-			return err
+		if payload == nil {
+			return nil
 		}
-	}
-	return nil
-}
-
-// DryRunScreen creates, and destroys a whole bunch of example screens.
-func (client *DatadogConnector) DryRunScreen(fs *FileSystem) error {
-	docs, err := fs.GetTemplates()
-	if err != nil {
-		return err
-	}
-	for _, doc := range docs {
-		var out CreateDashboardResp
-		if err := client.DoJSONRequest("POST", "/v1/screen", doc, &out); err != nil {
-			return err
+		scoped := client.forFile(template.Path)
+		id, err := scoped.UpsertBoard(kind, "", payload)
+		if err != nil {
+			return &FileError{template.Path, err}
 		}
-		if out.Dashboard == nil || out.Dashboard.ID == nil {
-			return fmt.Errorf("Response from datadog had no valid screen: %+v", out)
+		if err := scoped.DoJSONRequest("DELETE", fmt.Sprintf("%s/%s", kind.APIPath, id), nil, nil); err != nil {
+			return &FileError{template.Path, err}
 		}
-		if err := client.DoJSONRequest("DELETE", fmt.Sprintf("/v1/screen/%s", *out.Dashboard.ID), nil, nil); err != nil {
+		return nil
+	})
+	for _, err := range errs {
+		if err = collector.add(err); err != nil {
 			return err
 		}
 	}
-	return nil
-}
-
-// Fings a matching dashboard based on titles.
-func findDashboard(title string, dashboards []Dashboard) string {
-	for _, dash := range dashboards {
-		if dash.Title == nil {
-			continue
-		}
-		if dash.Title == &title {
-			return *dash.ID
-		}
-	}
-	return "-1"
-}
-
-// Fings a matching dashboard based on titles.
-func findScreenboard(title string, dashboards []Screenboard) int {
-	for _, dash := range dashboards {
-		if dash.Title == nil {
-			continue
-		}
-		if dash.Title == &title {
-			return *dash.ID
-		}
-	}
-	return -1
+	return collector.result()
 }
 
 // getDashAsMap gets a dashboard as a map[string]interface{} instead of map[interface{}]interface{}
@@ -322,79 +373,3 @@ func getDashAsMap(dash map[string]interface{}) map[string]interface{} {
 	}
 	return newMap
 }
-
-// CreateDashboards actually runs, and creates all the dashboards.
-func (client *DatadogConnector) CreateDashboards(fs *FileSystem) error {
-	docs, err := fs.GetTemplates()
-	if err != nil {
-		return err
-	}
-	for _, doc := range docs {
-		var out DashboardListResp
-		if err := client.DoJSONRequest("GET", "/v1/dash", nil, &out); err != nil {
-			return err
-		}
-		dashFrd := getDashAsMap(doc)
-		if dashFrd == nil {
-			continue
-		}
-		if val := findDashboard(dashFrd["title"].(string), out.Dashboards); val != "-1" {
-			if err = client.DoJSONRequest("DELETE", fmt.Sprintf("/v1/dash/%s", val), nil, nil); err != nil {
-				return err
-			}
-		}
-		marshaled, err := yaml.Marshal(&dashFrd)
-		if err != nil {
-			return err
-		}
-		asBytes, err := yamlToJSON(marshaled, nil)
-		if err != nil {
-			return err
-		}
-		var fromJSON map[string]interface{}
-		err = json.Unmarshal(asBytes, &fromJSON)
-		if err != nil {
-			return err
-		}
-		if err = client.DoJSONRequest("POST", "/v1/dash", fromJSON, nil); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-// CreateScreens actually runs, and creates all the screens.
-func (client *DatadogConnector) CreateScreens(fs *FileSystem) error {
-	docs, err := fs.GetTemplates()
-	if err != nil {
-		return err
-	}
-	for _, doc := range docs {
-		var out ScreensListResp
-		if err := client.DoJSONRequest("GET", "/v1/screen", nil, &out); err != nil {
-			return err
-		}
-		if val := findScreenboard(doc["board_title"].(string), out.Dashboards); val != -1 {
-			if err = client.DoJSONRequest("DELETE", fmt.Sprintf("/v1/screen/%d", val), nil, nil); err != nil {
-				return err
-			}
-		}
-		marshaled, err := yaml.Marshal(&doc)
-		if err != nil {
-			return err
-		}
-		asBytes, err := yamlToJSON(marshaled, nil)
-		if err != nil {
-			return err
-		}
-		var fromJSON map[string]interface{}
-		err = json.Unmarshal(asBytes, &fromJSON)
-		if err != nil {
-			return err
-		}
-		if err = client.DoJSONRequest("POST", "/v1/screen", fromJSON, nil); err != nil {
-			return err
-		}
-	}
-	return nil
-}
@@ -1,7 +1,9 @@
 package main
 
 import (
-	"os"
+	"errors"
+	"net/http"
+	"strings"
 	"testing"
 
 	gock "gopkg.in/h2non/gock.v1"
@@ -15,17 +17,10 @@ func TestValidate(t *testing.T) {
 		respData["errors"] = []string{"test"}
 		respData["valid"] = false
 
-		if value, ok := os.LookupEnv("DATADOG_HOST"); ok {
-			gock.New(value).
-				Get("/api/v1/validate").
-				Reply(200).
-				JSON(respData)
-		} else {
-			gock.New("https://app.datadoghq.com").
-				Get("/api/v1/validate").
-				Reply(200).
-				JSON(respData)
-		}
+		gock.New(testDatadogHost()).
+			Get("/api/v1/validate").
+			Reply(200).
+			JSON(respData)
 
 		connector := NewDatadogConnector("test", "test", 3)
 		valid, err := connector.Validate()
@@ -45,17 +40,10 @@ func TestValidate(t *testing.T) {
 		respData["errors"] = nil
 		respData["valid"] = true
 
-		if value, ok := os.LookupEnv("DATADOG_HOST"); ok {
-			gock.New(value).
-				Get("/api/v1/validate").
-				Reply(200).
-				JSON(respData)
-		} else {
-			gock.New("https://app.datadoghq.com").
-				Get("/api/v1/validate").
-				Reply(200).
-				JSON(respData)
-		}
+		gock.New(testDatadogHost()).
+			Get("/api/v1/validate").
+			Reply(200).
+			JSON(respData)
 
 		connector := NewDatadogConnector("test", "test", 3)
 		valid, err := connector.Validate()
@@ -68,3 +56,49 @@ func TestValidate(t *testing.T) {
 		}
 	})
 }
+
+func TestKeysAreSentAsHeaders(t *testing.T) {
+	defer gock.Off()
+
+	gock.New(testDatadogHost()).
+		Get("/api/v1/validate").
+		MatchHeader("DD-API-KEY", "^secret-api$").
+		MatchHeader("DD-APPLICATION-KEY", "^secret-app$").
+		AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+			return req.URL.RawQuery == "", nil
+		}).
+		Reply(200).
+		JSON(map[string]interface{}{"valid": true})
+
+	connector := NewDatadogConnector("secret-api", "secret-app", 3)
+	valid, err := connector.Validate()
+	if err != nil {
+		t.Fatalf("Validate with keys in headers failed: %v", err)
+	}
+	if !valid || !gock.IsDone() {
+		t.Fatal("Keys weren't sent as headers, or were still sent in the url!")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	defer gock.Off()
+
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash/1").
+		Reply(403).
+		BodyString(`{"errors": ["Invalid key secret-api"]}`)
+
+	connector := NewDatadogConnector("secret-api", "secret-app", 3)
+	err := connector.DoJSONRequest("GET", "/v1/dash/1", nil, nil)
+	if err == nil {
+		t.Fatal("Forbidden request didn't fail!")
+	}
+	if strings.Contains(err.Error(), "secret-api") || !strings.Contains(err.Error(), "[REDACTED]") {
+		t.Fatalf("Key wasn't redacted from the error: %v", err)
+	}
+
+	redacted := connector.redactError(errors.New("Get ?key=secret-app failed"))
+	if redacted.Error() != "Get ?key=[REDACTED] failed" {
+		t.Fatalf("Key wasn't redacted from the error: %v", redacted)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// FieldDiff is a single field that differs between what's in YAML, and what's in Datadog.
+// A nil Old means the field is being added, a nil New means it's being removed.
+type FieldDiff struct {
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+// String renders a diff the same way a plan prints it.
+func (diff FieldDiff) String() string {
+	switch {
+	case diff.Old == nil:
+		return fmt.Sprintf("+ %s: %s", diff.Path, formatValue(diff.New))
+	case diff.New == nil:
+		return fmt.Sprintf("- %s: %s", diff.Path, formatValue(diff.Old))
+	}
+	return fmt.Sprintf("~ %s: %s => %s", diff.Path, formatValue(diff.Old), formatValue(diff.New))
+}
+
+// formatValue renders a value as compact JSON for output.
+func formatValue(value interface{}) string {
+	asJSON, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(asJSON)
+}
+
+// joinPath builds the path of a key nested under parent.
+func joinPath(parent string, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// diffValues compares a desired value against a live one field by field. Only keys present
+// in desired are compared, since Datadog adds plenty of server side fields (ids, timestamps,
+// authors) we never manage.
+func diffValues(path string, desired, live interface{}) []FieldDiff {
+	diffs := []FieldDiff{}
+
+	switch typedDesired := desired.(type) {
+	case map[string]interface{}:
+		typedLive, ok := live.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := []string{}
+		for k := range typedDesired {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffs = append(diffs, diffValues(joinPath(path, k), typedDesired[k], typedLive[k])...)
+		}
+		return diffs
+	case []interface{}:
+		typedLive, ok := live.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(typedDesired) || i < len(typedLive); i++ {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(typedLive):
+				diffs = append(diffs, FieldDiff{itemPath, nil, typedDesired[i]})
+			case i >= len(typedDesired):
+				diffs = append(diffs, FieldDiff{itemPath, typedLive[i], nil})
+			default:
+				diffs = append(diffs, diffValues(itemPath, typedDesired[i], typedLive[i])...)
+			}
+		}
+		return diffs
+	}
+
+	if !reflect.DeepEqual(desired, live) {
+		diffs = append(diffs, FieldDiff{path, live, desired})
+	}
+	return diffs
+}
+
+// diffBoard compares a board's payload against the live board. Besides every field that differs,
+// fields that are set on the live board but missing from the payload, e.g. removed from YAML, or
+// added in the UI, are reported as removals.
+func diffBoard(kind BoardKind, desired, live interface{}) []FieldDiff {
+	s, _ := schemaFor(kind)
+	if s != nil && kind == DashKind {
+		// The payload of a timeboard is what's under dash in YAML.
+		s = s.Fields["dash"]
+	}
+	return append(diffValues("", desired, live), liveOnlyFields("", desired, live, s)...)
+}
+
+// liveOnlyFields finds the fields a schema knows about that are set on the live board, but
+// missing from the desired one. Fields the schema doesn't know about are never managed by
+// Greyhound, Datadog adds plenty of its own, and a zero value is what Datadog fills in for a
+// field that isn't set, so neither is reported.
+func liveOnlyFields(path string, desired, live interface{}, s *schema) []FieldDiff {
+	diffs := []FieldDiff{}
+	if s == nil {
+		return diffs
+	}
+	switch typedLive := live.(type) {
+	case map[string]interface{}:
+		typedDesired, ok := desired.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := []string{}
+		for k := range s.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			value, isLive := typedLive[k]
+			if !isLive || isZeroValue(value) {
+				continue
+			}
+			if desiredValue, ok := typedDesired[k]; ok {
+				diffs = append(diffs, liveOnlyFields(joinPath(path, k), desiredValue, value, s.Fields[k])...)
+			} else {
+				diffs = append(diffs, FieldDiff{joinPath(path, k), value, nil})
+			}
+		}
+	case []interface{}:
+		typedDesired, ok := desired.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(typedDesired) && i < len(typedLive); i++ {
+			diffs = append(diffs, liveOnlyFields(fmt.Sprintf("%s[%d]", path, i), typedDesired[i], typedLive[i], s.Items)...)
+		}
+	}
+	return diffs
+}
+
+// isZeroValue reports if a value parsed from JSON is empty.
+func isZeroValue(value interface{}) bool {
+	switch typed := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !typed
+	case string:
+		return typed == ""
+	case float64:
+		return typed == 0
+	case []interface{}:
+		return len(typed) == 0
+	case map[string]interface{}:
+		return len(typed) == 0
+	}
+	return false
+}
+
+// diffRendered compares two renders of the same board. Unlike diffValues every field is
+// managed, so fields that were removed are reported too.
+func diffRendered(path string, before, after interface{}) []FieldDiff {
+	diffs := append(diffValues(path, after, before), removedFields(path, before, after)...)
+	sort.SliceStable(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs
+}
+
+// removedFields finds the keys of maps in before that are missing from after.
+func removedFields(path string, before, after interface{}) []FieldDiff {
+	diffs := []FieldDiff{}
+	switch typedBefore := before.(type) {
+	case map[string]interface{}:
+		typedAfter, ok := after.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := []string{}
+		for k := range typedBefore {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if value, ok := typedAfter[k]; ok {
+				diffs = append(diffs, removedFields(joinPath(path, k), typedBefore[k], value)...)
+			} else {
+				diffs = append(diffs, FieldDiff{joinPath(path, k), typedBefore[k], nil})
+			}
+		}
+	case []interface{}:
+		typedAfter, ok := after.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(typedBefore) && i < len(typedAfter); i++ {
+			diffs = append(diffs, removedFields(fmt.Sprintf("%s[%d]", path, i), typedBefore[i], typedAfter[i])...)
+		}
+	}
+	return diffs
+}
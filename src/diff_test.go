@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffValues(t *testing.T) {
+	t.Run("Ignores Server Side Fields", func(t *testing.T) {
+		desired := map[string]interface{}{"title": "Board"}
+		live := map[string]interface{}{"title": "Board", "id": 1234.0, "modified": "yesterday"}
+
+		if diffs := diffValues("", desired, live); len(diffs) != 0 {
+			t.Fatalf("Server side fields showed up as a diff: [ %+v ]", diffs)
+		}
+	})
+
+	t.Run("Finds Nested Changes", func(t *testing.T) {
+		desired := map[string]interface{}{
+			"title": "Board",
+			"graphs": []interface{}{
+				map[string]interface{}{"title": "New"},
+				map[string]interface{}{"title": "Added"},
+			},
+		}
+		live := map[string]interface{}{
+			"title": "Board",
+			"graphs": []interface{}{
+				map[string]interface{}{"title": "Old"},
+			},
+		}
+
+		diffs := diffValues("", desired, live)
+		expected := []FieldDiff{
+			{"graphs[0].title", "Old", "New"},
+			{"graphs[1]", nil, map[string]interface{}{"title": "Added"}},
+		}
+		if !reflect.DeepEqual(diffs, expected) {
+			t.Fatalf("Diffs were not correct: \n [ %+v ] \n [ %+v ]", diffs, expected)
+		}
+	})
+
+	t.Run("Finds Removed List Items", func(t *testing.T) {
+		desired := map[string]interface{}{"tags": []interface{}{"a"}}
+		live := map[string]interface{}{"tags": []interface{}{"a", "b"}}
+
+		diffs := diffValues("", desired, live)
+		if len(diffs) != 1 || diffs[0].String() != "- tags[1]: \"b\"" {
+			t.Fatalf("Removed item was not found: [ %+v ]", diffs)
+		}
+	})
+
+	t.Run("Finds Live Only Fields", func(t *testing.T) {
+		desired := map[string]interface{}{
+			"board_title": "Board",
+			"widgets":     []interface{}{map[string]interface{}{"type": "note"}},
+		}
+		live := map[string]interface{}{
+			"board_title": "Board",
+			"description": "",
+			"read_only":   true,
+			"widgets":     []interface{}{map[string]interface{}{"type": "note", "title_text": "From the UI", "id": 7.0}},
+			"id":          1234.0,
+		}
+
+		diffs := diffBoard(ScreenKind, desired, live)
+		expected := []FieldDiff{
+			{"read_only", true, nil},
+			{"widgets[0].title_text", "From the UI", nil},
+		}
+		if !reflect.DeepEqual(diffs, expected) {
+			t.Fatalf("Live only fields were not found: \n [ %+v ] \n [ %+v ]", diffs, expected)
+		}
+	})
+}
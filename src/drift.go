@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Drift is a board Greyhound owns that was changed outside of git.
+type Drift struct {
+	Kind BoardKind
+	// The YAML file that owns the board.
+	File  string
+	Title string
+	ID    string
+	// Deleted is set when the board no longer exists at all.
+	Deleted bool
+	// The fields that differ between the YAML, and the live board.
+	Diffs []FieldDiff
+}
+
+// DriftReport is every board of a run that was changed outside of git.
+type DriftReport struct {
+	Drifts []Drift
+}
+
+// DetectDrift compares every board of a kind that Greyhound owns against its YAML. Only files
+// that haven't changed since they were last applied are compared, a file with unapplied changes
+// is expected to differ from what's live.
+func (client *DatadogConnector) DetectDrift(kind BoardKind, fs *FileSystem) (*DriftReport, error) {
+	templates, err := fs.GetTemplateFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DriftReport{}
+	lazy := &lazyBoardIndex{client: client, kind: kind}
+	for _, template := range templates {
+		state, err := fs.GetState(template.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !state.unchanged(kind, template.Hash) {
+			continue
+		}
+		payload, title, err := kind.payloadAndTitle(template)
+		if err != nil {
+			return nil, &FileError{template.Path, err}
+		}
+		if payload == nil {
+			continue
+		}
+
+		drift := Drift{Kind: kind, File: template.Path, Title: title, ID: state.ID}
+		index, err := lazy.get()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := index.byID[state.ID]; !ok {
+			drift.Deleted = true
+			report.Drifts = append(report.Drifts, drift)
+			continue
+		}
+		current, err := client.forFile(template.Path).GetBoard(kind, state.ID)
+		if err != nil {
+			return nil, &FileError{template.Path, err}
+		}
+		if drift.Diffs = diffBoard(kind, payload, current); len(drift.Diffs) > 0 {
+			report.Drifts = append(report.Drifts, drift)
+		}
+	}
+	return report, nil
+}
+
+// Write prints the report out in a human readable diff. The diffs are printed from the live
+// board to the YAML, so they show what the next apply would undo.
+func (report *DriftReport) Write(w io.Writer) {
+	for _, drift := range report.Drifts {
+		if drift.Deleted {
+			fmt.Fprintf(w, "  ! %s %q (%s) [id: %s] was deleted outside of git\n", drift.Kind.Name, drift.Title, drift.File, drift.ID)
+			continue
+		}
+		fmt.Fprintf(w, "  ! %s %q (%s) [id: %s] was changed outside of git:\n", drift.Kind.Name, drift.Title, drift.File, drift.ID)
+		for _, diff := range drift.Diffs {
+			fmt.Fprintf(w, "      %s\n", diff)
+		}
+	}
+	fmt.Fprintf(w, "Drift: %d boards changed outside of git.\n", len(report.Drifts))
+}
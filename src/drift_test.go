@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestDetectDrift(t *testing.T) {
+	defer gock.Off()
+
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"edited.yml":    "---\ndash:\n  title: Edited Board\n  description: from git\n",
+		"deleted.yml":   "---\ndash:\n  title: Deleted Board\n",
+		"same.yml":      "---\ndash:\n  title: Same Board\n",
+		"ui.yml":        "---\ndash:\n  title: UI Board\n",
+		"unapplied.yml": "---\ndash:\n  title: Unapplied Board\n",
+		"unmanaged.yml": "---\ndash:\n  title: Unmanaged Board\n",
+	})
+	defer cleanup()
+
+	templates, err := fs.GetTemplateFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, template := range templates {
+		id := map[string]string{
+			"src/configs/deleted.yml":   "1",
+			"src/configs/edited.yml":    "2",
+			"src/configs/same.yml":      "3",
+			"src/configs/unapplied.yml": "4",
+			"src/configs/ui.yml":        "5",
+		}[template.Path]
+		if id == "" {
+			continue
+		}
+		hash := hashString(template.Hash)
+		if id == "4" {
+			hash = "out-of-date"
+		}
+		if err = fs.PutState(BoardState{template.Path, "dash", id, hash}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash$").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"dashes": []map[string]interface{}{
+				{"id": "2", "title": "Edited Board"},
+				{"id": "3", "title": "Same Board"},
+				{"id": "4", "title": "Unapplied Board"},
+				{"id": "5", "title": "UI Board"},
+			},
+		})
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash/2").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"dash": map[string]interface{}{"id": 2, "title": "Edited Board", "description": "from the UI"},
+		})
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash/3").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"dash": map[string]interface{}{"id": 3, "title": "Same Board", "read_only": false},
+		})
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash/5").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"dash": map[string]interface{}{"id": 5, "title": "UI Board", "read_only": true, "modified": "today"},
+		})
+
+	connector := NewDatadogConnector("test", "test", 3)
+	report, err := connector.DetectDrift(DashKind, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Drifts) != 3 || !report.Drifts[0].Deleted || report.Drifts[1].ID != "2" || report.Drifts[2].ID != "5" {
+		t.Fatalf("Drift report was not correct: [ %+v ]", report.Drifts)
+	}
+
+	var out bytes.Buffer
+	report.Write(&out)
+	for _, expected := range []string{
+		"! dash \"Deleted Board\" (src/configs/deleted.yml) [id: 1] was deleted outside of git",
+		"! dash \"Edited Board\" (src/configs/edited.yml) [id: 2] was changed outside of git:",
+		"~ description: \"from the UI\" => \"from git\"",
+		"! dash \"UI Board\" (src/configs/ui.yml) [id: 5] was changed outside of git:",
+		"- read_only: true",
+		"Drift: 3 boards changed outside of git.",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Fatalf("Drift output is missing [ %s ]: \n%s", expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ParseError is a YAML file that couldn't be parsed.
+type ParseError struct {
+	// The YAML file that failed to parse.
+	Path string
+	Err  error
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("%s: failed to parse: %v", err.Path, err.Err)
+}
+
+// APIError is a request Datadog responded to with a non 2xx status.
+type APIError struct {
+	Method string
+	// The API path that was requested, never the full URL so keys can't leak.
+	API        string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (err *APIError) Error() string {
+	return fmt.Sprintf("API error %s (%s %s): %s", err.Status, err.Method, err.API, err.Body)
+}
+
+// FileError is a failure syncing the board from a single YAML file.
+type FileError struct {
+	// The YAML file the board came from.
+	Path string
+	Err  error
+}
+
+func (err *FileError) Error() string {
+	return fmt.Sprintf("%s: %v", err.Path, err.Err)
+}
+
+// FileErrors is every file that failed during a run. Each error names the file it's for.
+type FileErrors []error
+
+func (errs FileErrors) Error() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d files failed:", len(errs))
+	for _, err := range errs {
+		fmt.Fprintf(&buf, "\n  %v", err)
+	}
+	return buf.String()
+}
+
+// errorCollector decides what to do when a file fails during a run. Normally the run stops at
+// the first failure, but when keepGoing is set failures are collected, and the run carries on
+// so every failure can be reported at the end. Errors that aren't about a single file, like
+// failing to list boards, always stop the run.
+type errorCollector struct {
+	keepGoing bool
+	errs      FileErrors
+}
+
+// add records a failure. The error to stop the run with is returned, which is nil if the run
+// should keep going.
+func (collector *errorCollector) add(err error) error {
+	if err == nil || !collector.keepGoing {
+		return err
+	}
+	switch typed := err.(type) {
+	case FileErrors:
+		collector.errs = append(collector.errs, typed...)
+	case *FileError, *ParseError:
+		collector.errs = append(collector.errs, typed)
+	default:
+		return err
+	}
+	return nil
+}
+
+// addFile records a failure syncing the board from a single file.
+func (collector *errorCollector) addFile(path string, err error) error {
+	return collector.add(&FileError{path, err})
+}
+
+// result returns every failure collected, or nil if nothing failed.
+func (collector *errorCollector) result() error {
+	if len(collector.errs) == 0 {
+		return nil
+	}
+	return collector.errs
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrorCollector(t *testing.T) {
+	fileErr := &FileError{"a.yml", errors.New("boom")}
+	fatal := errors.New("couldn't list boards")
+
+	t.Run("Stops At First Failure", func(t *testing.T) {
+		collector := &errorCollector{}
+		if err := collector.add(fileErr); err != fileErr {
+			t.Fatalf("Failure wasn't returned to stop the run: [ %+v ]", err)
+		}
+	})
+
+	t.Run("Keep Going Collects File Failures", func(t *testing.T) {
+		collector := &errorCollector{keepGoing: true}
+		if err := collector.add(fileErr); err != nil {
+			t.Fatalf("File failure stopped the run: [ %+v ]", err)
+		}
+		if err := collector.add(FileErrors{&ParseError{"b.yml", errors.New("bad")}}); err != nil {
+			t.Fatalf("File failures stopped the run: [ %+v ]", err)
+		}
+		if err := collector.add(fatal); err != fatal {
+			t.Fatalf("Failure that isn't about a file didn't stop the run: [ %+v ]", err)
+		}
+		expected := "2 files failed:\n  a.yml: boom\n  b.yml: failed to parse: bad"
+		if err := collector.result(); err == nil || err.Error() != expected {
+			t.Fatalf("Collected failures weren't reported: [ %+v ]", err)
+		}
+	})
+}
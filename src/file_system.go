@@ -3,11 +3,11 @@ package main
 import (
 	"crypto/sha512"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/spf13/afero"
 	"github.com/syndtr/goleveldb/leveldb"
-	"gopkg.in/yaml.v2"
 )
 
 // FileSystem handles things on the FileSystem for GreyHound. This helps maintain a Cache,
@@ -23,8 +23,38 @@ type FileSystem struct {
 	fileHashMap map[string][sha512.Size]byte
 	// A Map of <filepath, contents>.
 	fileDataMap map[string][]byte
+	// A Map of <filepath, contents> for the values files templates are rendered with.
+	valuesDataMap map[string][]byte
+	// A Map of <filepath, contents> for the partials templates can include.
+	partialDataMap map[string][]byte
+	// A Map of <filepath, contents> for every file of every overlay.
+	overlayDataMap map[string][]byte
 	// A Map of <sha512 hash, parsed yaml>
 	fileRenderMap map[[sha512.Size]byte]map[string]interface{}
+	// Every template rendered by the last render, sorted by path.
+	templates []Template
+	// A Map of <filepath, template paths> for every file that rendered successfully.
+	renderedPaths map[string][]string
+	// Env picks the overlay applied on top of the base boards, none if it's empty.
+	Env string
+}
+
+// Template is a single rendered board, along with the file it came from.
+type Template struct {
+	// The path of the board. For a file that renders a single board this is the path of the
+	// file, and for a file that's expanded into many it's the path of the file, followed by
+	// the board's name (e.g. services.yml#api).
+	Path string
+	// The path of the file this template was rendered from.
+	Source string
+	// The sha512 hash of the rendered yaml.
+	Hash [sha512.Size]byte
+	// The parsed yaml.
+	Contents map[string]interface{}
+	// The rendered yaml, with any partials it includes in place.
+	Data []byte
+	// The partial files the template includes, sorted.
+	Dependencies []string
 }
 
 // CreateFileSystem Creates a FileSystem to list files/maintain a cache.
@@ -39,7 +69,13 @@ func CreateFileSystem(rootDir string, cacheDir string, backendFs afero.Fs) (file
 		rootDir,
 		nil,
 		nil,
+		nil,
+		nil,
+		nil,
 		map[[sha512.Size]byte]map[string]interface{}{},
+		nil,
+		nil,
+		"",
 	}
 	return fs, nil
 }
@@ -49,10 +85,14 @@ func (fs *FileSystem) Close() {
 	fs.cache.Close()
 }
 
-// WalkDirectory updates a directory of files for their latest hashes + data.
+// WalkDirectory updates a directory of files for their latest hashes + data. Values files,
+// partials, and overlays are read too, but aren't returned as they don't describe a board.
 func (fs *FileSystem) WalkDirectory() (res []string, err error) {
 	fileHashMap := make(map[string][sha512.Size]byte)
 	fileDataMap := make(map[string][]byte)
+	valuesDataMap := make(map[string][]byte)
+	partialDataMap := make(map[string][]byte)
+	overlayDataMap := make(map[string][]byte)
 
 	err = afero.Walk(fs.appFs, fs.RootDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -67,6 +107,18 @@ func (fs *FileSystem) WalkDirectory() (res []string, err error) {
 			if err != nil {
 				return err
 			}
+			if fs.isOverlayFile(path) {
+				overlayDataMap[path] = data
+				return nil
+			}
+			if fs.isPartialFile(path) {
+				partialDataMap[path] = data
+				return nil
+			}
+			if isValuesFile(path) {
+				valuesDataMap[path] = data
+				return nil
+			}
 			digest := sha512.Sum512(data)
 			fileHashMap[path] = digest
 			fileDataMap[path] = data
@@ -80,16 +132,36 @@ func (fs *FileSystem) WalkDirectory() (res []string, err error) {
 
 	fs.fileDataMap = fileDataMap
 	fs.fileHashMap = fileHashMap
+	fs.valuesDataMap = valuesDataMap
+	fs.partialDataMap = partialDataMap
+	fs.overlayDataMap = overlayDataMap
 
 	keys := []string{}
 	for k := range fileHashMap {
 		keys = append(keys, k)
 	}
 
-	fs.updateCache()
+	if err = fs.updateCache(); err != nil {
+		return nil, err
+	}
 	return keys, nil
 }
 
+// fileHashes returns the sha512 hash of every YAML file read by the last WalkDirectory, boards
+// as well as the values files, partials, and overlays they're rendered with.
+func (fs *FileSystem) fileHashes() map[string][sha512.Size]byte {
+	hashes := make(map[string][sha512.Size]byte)
+	for path, hash := range fs.fileHashMap {
+		hashes[path] = hash
+	}
+	for _, dataMap := range []map[string][]byte{fs.valuesDataMap, fs.partialDataMap, fs.overlayDataMap} {
+		for path, data := range dataMap {
+			hashes[path] = sha512.Sum512(data)
+		}
+	}
+	return hashes
+}
+
 // UpdateCache updates the leveldb cache with the current file path + hashes.
 func (fs *FileSystem) updateCache() error {
 	for k, v := range fs.fileHashMap {
@@ -111,35 +183,64 @@ func (fs *FileSystem) GetFileHash(filename string) ([]byte, error) {
 	return data, nil
 }
 
-// RenderTemplates renders templates for all files on the file system
+// RenderTemplates renders templates for all files on the file system. Every file that fails
+// to render, or parse is returned as a ParseError inside of FileErrors, not just the first one.
 func (fs *FileSystem) RenderTemplates() error {
-	fs.WalkDirectory()
+	files, err := fs.WalkDirectory()
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
 
-	for fileName, contents := range fs.fileDataMap {
-		if fs.fileRenderMap[fs.fileHashMap[fileName]] == nil {
-			m := make(map[string]interface{})
-			err := yaml.Unmarshal(contents, &m)
-			if err != nil {
-				return err
-			}
-			fs.fileRenderMap[fs.fileHashMap[fileName]] = m
+	errs := FileErrors{}
+	templates := []Template{}
+	renderedPaths := make(map[string][]string)
+	for _, fileName := range files {
+		rendered, err := fs.renderFile(fileName)
+		if err != nil {
+			errs = append(errs, &ParseError{fileName, err})
+			continue
+		}
+		for _, template := range rendered {
+			templates = append(templates, template)
+			renderedPaths[fileName] = append(renderedPaths[fileName], template.Path)
 		}
 	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Path < templates[j].Path })
+	fs.templates = templates
+	fs.renderedPaths = renderedPaths
 
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
 // GetTemplates returns a list of templates that have been parsed.
 func (fs *FileSystem) GetTemplates() ([]map[string]interface{}, error) {
-	err := fs.RenderTemplates()
+	templates, err := fs.GetTemplateFiles()
 	if err != nil {
 		return nil, err
 	}
 
 	arr := []map[string]interface{}{}
-	for _, v := range fs.fileRenderMap {
-		arr = append(arr, v)
+	for _, template := range templates {
+		arr = append(arr, template.Contents)
 	}
 
 	return arr, nil
 }
+
+// GetTemplateFiles returns every parsed template along with the file it came from, sorted by path.
+// If some files fail to parse, the templates that did parse are still returned alongside the
+// FileErrors so a caller can choose to carry on without them.
+func (fs *FileSystem) GetTemplateFiles() ([]Template, error) {
+	renderErr := fs.RenderTemplates()
+	if _, ok := renderErr.(FileErrors); renderErr != nil && !ok {
+		return nil, renderErr
+	}
+
+	arr := make([]Template, len(fs.templates))
+	copy(arr, fs.templates)
+	return arr, renderErr
+}
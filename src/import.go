@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+// serverOnlyFields are fields Datadog adds to a board, and everything in it (e.g. the id of every
+// widget) that can't be set through the API, so they're stripped from imported boards.
+var serverOnlyFields = []string{
+	"id",
+	"new_id",
+	"created",
+	"modified",
+	"created_at",
+	"modified_at",
+	"created_by",
+	"author_handle",
+	"author_name",
+}
+
+// boardOnlyServerFields are only added by Datadog to the board itself. Widgets can have fields of
+// the same name, e.g. the url of an image widget, so they're left alone in there.
+var boardOnlyServerFields = []string{
+	"resource",
+	"url",
+}
+
+// slugify turns a title into something safe to use as a file name.
+func slugify(title string) string {
+	slug := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, title)
+	for strings.Contains(slug, "--") {
+		slug = strings.Replace(slug, "--", "-", -1)
+	}
+	slug = strings.Trim(slug, "-")
+	if slug == "" {
+		slug = "board"
+	}
+	return slug
+}
+
+// stripServerFields returns a copy of value without any serverOnlyFields, however deeply they're
+// nested in maps, and lists.
+func stripServerFields(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		stripped := make(map[string]interface{}, len(typed))
+		for k, v := range typed {
+			stripped[k] = stripServerFields(v)
+		}
+		for _, field := range serverOnlyFields {
+			delete(stripped, field)
+		}
+		return stripped
+	case []interface{}:
+		stripped := make([]interface{}, len(typed))
+		for i, item := range typed {
+			stripped[i] = stripServerFields(item)
+		}
+		return stripped
+	}
+	return value
+}
+
+// boardToYAML renders a live board as the YAML file Greyhound would read it back from.
+func boardToYAML(kind BoardKind, board map[string]interface{}) ([]byte, error) {
+	cleaned := stripServerFields(board).(map[string]interface{})
+	for _, field := range boardOnlyServerFields {
+		delete(cleaned, field)
+	}
+
+	var doc interface{} = cleaned
+	if kind == DashKind {
+		doc = map[string]interface{}{"dash": cleaned}
+	}
+	// Maps are always marshaled with sorted keys, so the output is stable between imports.
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("---\n"), data...), nil
+}
+
+// importPath picks a file for an imported board that doesn't exist yet, or "" if there isn't one.
+func (fs *FileSystem) importPath(board LiveBoard) (string, error) {
+	slug := slugify(board.Title)
+	for _, name := range []string{slug + ".yml", slug + "-" + board.ID + ".yml"} {
+		path := filepath.Join(fs.RootDir, name)
+		exists, err := afero.Exists(fs.appFs, path)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// ImportBoards writes every board of a kind that Greyhound doesn't already own into a YAML
+// file under fs.RootDir, and records the file as owning the board. The paths of the written
+// files are returned.
+func (client *DatadogConnector) ImportBoards(kind BoardKind, fs *FileSystem) ([]string, error) {
+	live, err := client.ListBoards(kind)
+	if err != nil {
+		return nil, err
+	}
+	states, err := fs.ListStates()
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[string]bool)
+	for _, state := range states {
+		if state.Kind == kind.Name {
+			owned[state.ID] = true
+		}
+	}
+	if err = fs.appFs.MkdirAll(fs.RootDir, 0755); err != nil {
+		return nil, err
+	}
+
+	written := []string{}
+	for _, board := range live {
+		if owned[board.ID] {
+			continue
+		}
+		path, err := fs.importPath(board)
+		if err != nil {
+			return nil, err
+		}
+		if path == "" {
+			return nil, fmt.Errorf("Couldn't find a free file name to import %s %q [id: %s]", kind.Name, board.Title, board.ID)
+		}
+
+		definition, err := client.forFile(path).GetBoard(kind, board.ID)
+		if err != nil {
+			return nil, err
+		}
+		data, err := boardToYAML(kind, definition)
+		if err != nil {
+			return nil, err
+		}
+		if err = afero.WriteFile(fs.appFs, path, data, 0644); err != nil {
+			return nil, err
+		}
+		// The file is exactly what's live, so record it as already applied.
+		if err = fs.PutState(BoardState{path, kind.Name, board.ID, hashString(sha512.Sum512(data))}); err != nil {
+			return nil, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
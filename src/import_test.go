@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestSlugify(t *testing.T) {
+	for title, expected := range map[string]string{
+		"My Service -- Overview!": "my-service-overview",
+		"p99 Latency (prod)":      "p99-latency-prod",
+		"???":                     "board",
+	} {
+		if slug := slugify(title); slug != expected {
+			t.Fatalf("Slug for [ %s ] was [ %s ] not [ %s ]", title, slug, expected)
+		}
+	}
+}
+
+func TestImportBoards(t *testing.T) {
+	defer gock.Off()
+
+	fs, cleanup := createTestFileSystem(t, map[string]string{})
+	defer cleanup()
+	if err := fs.PutState(BoardState{"src/configs/owned.yml", "dash", "2", ""}); err != nil {
+		t.Fatal(err)
+	}
+
+	live := map[string]interface{}{
+		"id":          1,
+		"title":       "Hand Made",
+		"description": "Built in the UI for {{host.name}}",
+		"created":     "2017-05-01T00:00:00.000000+00:00",
+		"modified":    "2017-05-02T00:00:00.000000+00:00",
+		"created_by":  map[string]interface{}{"handle": "someone@example.com"},
+		"graphs": []interface{}{
+			map[string]interface{}{
+				"id":         1234567,
+				"title":      "CPU",
+				"definition": map[string]interface{}{"viz": "timeseries", "requests": []interface{}{}},
+			},
+			map[string]interface{}{
+				"id":         1234568,
+				"title":      "Runbook",
+				"definition": map[string]interface{}{"viz": "image", "url": "https://example.com/runbook.png"},
+			},
+		},
+	}
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash$").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"dashes": []map[string]interface{}{
+				{"id": "1", "title": "Hand Made"},
+				{"id": "2", "title": "Already Owned"},
+			},
+		})
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash/1").
+		Reply(200).
+		JSON(map[string]interface{}{"dash": live})
+
+	connector := NewDatadogConnector("test", "test", 3)
+	written, err := connector.ImportBoards(DashKind, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 1 || written[0] != "src/configs/hand-made.yml" {
+		t.Fatalf("Imported files were not correct: [ %+v ]", written)
+	}
+
+	data, err := afero.ReadFile(fs.appFs, written[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `---
+dash:
+  description: Built in the UI for {{host.name}}
+  graphs:
+  - definition:
+      requests: []
+      viz: timeseries
+    title: CPU
+  - definition:
+      url: https://example.com/runbook.png
+      viz: image
+    title: Runbook
+  title: Hand Made
+`
+	if string(data) != expected {
+		t.Fatalf("Imported YAML was not correct: \n%s", data)
+	}
+
+	// Reading the file back should give exactly what's live, Datadog's {{ }} variables included.
+	templates, err := fs.GetTemplateFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := DashKind.Payload(templates[0].Contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := toJSONMap(live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs := diffValues("", payload, current); len(diffs) != 0 {
+		t.Fatalf("Imported board doesn't round trip: [ %+v ]", diffs)
+	}
+
+	state, err := fs.GetState(written[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.unchanged(DashKind, templates[0].Hash) || state.ID != "1" {
+		t.Fatalf("Imported board was not recorded as applied: [ %+v ]", state)
+	}
+}
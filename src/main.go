@@ -1,80 +1,166 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"os"
+	"text/tabwriter"
 
 	"github.com/spf13/afero"
 )
 
-var dryRun = flag.Bool("dry-run", false, "Whether or not to run a Dry Run.")
+// managedBoards is a kind of board Greyhound manages, and the FileSystem holding its YAML.
+type managedBoards struct {
+	kind BoardKind
+	fs   *FileSystem
+}
 
-func main() {
-	fmt.Println("Starting Greyhound...")
+// buildPlan builds a single plan covering every kind of board.
+// With opts.KeepGoing, the plan is returned alongside any files that failed.
+func buildPlan(ddConnector *DatadogConnector, boards []managedBoards, opts SyncOptions) (*Plan, error) {
+	collector := &errorCollector{keepGoing: opts.KeepGoing}
+	plan := &Plan{}
+	for _, managed := range boards {
+		kindPlan, err := ddConnector.BuildPlan(managed.kind, managed.fs, opts)
+		if err = collector.add(err); err != nil {
+			return nil, err
+		}
+		plan.Changes = append(plan.Changes, kindPlan.Changes...)
+	}
+	return plan, collector.result()
+}
 
-	fmt.Println("Creating Datadog Client...")
-	ddConnector := NewDatadogConnector(os.Getenv("DATADOG_API_KEY"), os.Getenv("DATADOG_APP_KEY"), 10)
-	isValid, err := ddConnector.Validate()
-	if err != nil {
-		fmt.Printf("Failed to query datadog: %v\n", err)
-		os.Exit(1)
+// detectDrift checks every kind of board for changes made outside of git.
+func detectDrift(ddConnector *DatadogConnector, boards []managedBoards) (*DriftReport, error) {
+	report := &DriftReport{}
+	for _, managed := range boards {
+		kindReport, err := ddConnector.DetectDrift(managed.kind, managed.fs)
+		if err != nil {
+			return nil, err
+		}
+		report.Drifts = append(report.Drifts, kindReport.Drifts...)
 	}
-	if !isValid {
-		fmt.Printf("Datadog Credentials aren't valid\n")
-		os.Exit(1)
+	return report, nil
+}
+
+// validateBoards validates every kind of board.
+func validateBoards(boards []managedBoards) ([]*ValidationError, error) {
+	errs := []*ValidationError{}
+	for _, managed := range boards {
+		kindErrs, err := managed.fs.Validate(managed.kind)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, kindErrs...)
 	}
+	return errs, nil
+}
 
-	fmt.Println("Creating FileSystem client for Dashboards...")
-	fs, err := CreateFileSystem(os.Getenv("GREYDOG_DASH_PATH"), os.Getenv("GREYDOG_CACHE_DASH_PATH"), afero.NewOsFs())
-	if err != nil {
-		fmt.Printf("Failed to Create FileSystem for Dashs: %v\n", err)
-		os.Exit(1)
+// convertBoards converts every timeboard, and screenboard into a dashboard.
+func convertBoards(boards []managedBoards, opts SyncOptions) ([]string, error) {
+	var to *FileSystem
+	for _, managed := range boards {
+		if managed.kind == DashboardKind {
+			to = managed.fs
+		}
+	}
+	if to == nil {
+		return nil, fmt.Errorf("The dashboard kind must be configured to convert boards into dashboards, set %s", pathSetting(DashboardKind).describe("boards.dashboard.path"))
 	}
 
-	fsScreen, err := CreateFileSystem(os.Getenv("GREYDOG_SCREEN_PATH"), os.Getenv("GREYDOG_CACHE_SCREEN_PATH"), afero.NewOsFs())
-	if err != nil {
-		fmt.Printf("Failed to Create FileSystem for Screens: %v\n", err)
-		os.Exit(1)
+	collector := &errorCollector{keepGoing: opts.KeepGoing}
+	written := []string{}
+	// Timeboards, and screenboards are converted into the same directory, so can collide.
+	converted := make(map[string]string)
+	for _, managed := range boards {
+		if managed.kind == DashboardKind {
+			continue
+		}
+		paths, err := ConvertBoards(managed.kind, managed.fs, to, converted, opts)
+		if err = collector.add(err); err != nil {
+			return nil, err
+		}
+		written = append(written, paths...)
 	}
+	return written, collector.result()
+}
 
-	if *dryRun {
-		fmt.Println("Running a Dry run of Dashboards.")
-		err = ddConnector.DryRunDash(fs)
+// selectEnv applies an env's overlay to every kind of board. At least one kind must have an
+// overlay for the env, so a typo doesn't quietly deploy the base boards.
+func selectEnv(boards []managedBoards, env string) error {
+	found := false
+	for _, managed := range boards {
+		exists, err := managed.fs.HasOverlay(env)
 		if err != nil {
-			fmt.Println("Ran into an error on dry run dash!")
-			fmt.Print(err)
-			os.Exit(1)
-		} else {
-			fmt.Println("Successful!")
+			return err
 		}
-		fmt.Println("Running a Dry run of Screens")
-		err = ddConnector.DryRunScreen(fsScreen)
-		if err != nil {
-			fmt.Println("Ran into an error on dry run screen!")
-			fmt.Print(err)
-			os.Exit(1)
-		} else {
-			fmt.Println("Successful!")
+		found = found || exists
+		managed.fs.Env = env
+	}
+	if !found {
+		return fmt.Errorf("No overlay found for env %q, expected a %s/%s directory", env, overlaysDir, env)
+	}
+	return nil
+}
+
+// runCacheCommand manages the record of which file owns which board.
+func runCacheCommand(run *commandRun, args []string) error {
+	if len(args) == 0 {
+		return &usageError{"Usage: greyhound cache <list|rm|import>"}
+	}
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return &usageError{"Usage: greyhound cache list"}
 		}
-	} else {
-		fmt.Println("Creating Dashboards...")
-		err = ddConnector.CreateDashboards(fs)
-		if err != nil {
-			fmt.Println("Ran into an error Creating Dashboards!")
-			fmt.Print(err)
-			os.Exit(1)
-		} else {
-			fmt.Println("Successful!")
+		w := tabwriter.NewWriter(run.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "KIND\tID\tFILE")
+		for _, managed := range run.boards {
+			states, err := managed.fs.ListStates()
+			if err != nil {
+				return err
+			}
+			for _, state := range states {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", state.Kind, state.ID, state.Path)
+			}
 		}
-		fmt.Println("Creating Screenboareds...")
-		err = ddConnector.CreateScreens(fsScreen)
-		if err != nil {
-			fmt.Println("Ran into an error Creating Screens!")
-			fmt.Print(err)
-			os.Exit(1)
-		} else {
-			fmt.Println("Successful.")
+		return w.Flush()
+	case "rm":
+		if len(args) != 2 {
+			return &usageError{"Usage: greyhound cache rm <file>"}
+		}
+		for _, managed := range run.boards {
+			state, err := managed.fs.GetState(args[1])
+			if err != nil {
+				return err
+			}
+			if state != nil {
+				return managed.fs.DeleteState(args[1])
+			}
+		}
+		return fmt.Errorf("No state is recorded for: %s", args[1])
+	case "import":
+		if len(args) != 4 {
+			return &usageError{"Usage: greyhound cache import <dash|screen|dashboard> <file> <id>"}
+		}
+		for _, managed := range run.boards {
+			if managed.kind.Name != args[1] {
+				continue
+			}
+			client, err := run.connect()
+			if err != nil {
+				return err
+			}
+			if _, err := client.GetBoard(managed.kind, args[3]); err != nil {
+				return err
+			}
+			return managed.fs.PutState(BoardState{args[2], managed.kind.Name, args[3], ""})
 		}
+		return &usageError{fmt.Sprintf("Unknown, or unconfigured board kind: %s", args[1])}
 	}
+	return &usageError{fmt.Sprintf("Unknown cache command: %s", args[0])}
+}
+
+func main() {
+	c := &cli{appFs: afero.NewOsFs(), getenv: os.Getenv, out: os.Stdout, errOut: os.Stderr}
+	os.Exit(c.run(os.Args[1:]))
 }
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// overlaysDir is the directory under RootDir overlays are read from, with a directory per env.
+	overlaysDir = "_overlays"
+	// jsonPatchSuffix marks an overlay file as a JSON patch, rather than a strategic merge.
+	jsonPatchSuffix = ".patch.yml"
+)
+
+// mergeKeys are the fields that identify an item in a list of maps, in the order they're tried.
+// A strategic merge patches the item with the same key, rather than replacing the whole list.
+var mergeKeys = []string{"name", "title", "title_text"}
+
+// isOverlayFile reports if a file belongs to an overlay, rather than the base.
+func (fs *FileSystem) isOverlayFile(path string) bool {
+	rel, err := filepath.Rel(filepath.Join(fs.RootDir, overlaysDir), path)
+	return err == nil && !strings.HasPrefix(rel, "..")
+}
+
+// overlayPath returns where the overlay for the current env keeps the file at path in the base.
+func (fs *FileSystem) overlayPath(path string) string {
+	rel, err := filepath.Rel(fs.RootDir, path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	return filepath.Join(fs.RootDir, overlaysDir, fs.Env, rel)
+}
+
+// HasOverlay reports if there's an overlay for an env.
+func (fs *FileSystem) HasOverlay(env string) (bool, error) {
+	return afero.DirExists(fs.appFs, filepath.Join(fs.RootDir, overlaysDir, env))
+}
+
+// renderOverlayFile runs an overlay file through text/template with the board's values if it's a
+// template, and converts the YAML it renders to into JSON values.
+func renderOverlayFile(path string, data []byte, values map[string]interface{}) (interface{}, error) {
+	rendered, err := renderTemplate(filepath.Base(path), data, values)
+	if err != nil {
+		return nil, fmt.Errorf("overlay %s: %v", path, err)
+	}
+	asJSON, err := yamlToJSON(rendered, nil)
+	if err != nil {
+		return nil, fmt.Errorf("overlay %s: %v", path, err)
+	}
+	var out interface{}
+	if err = json.Unmarshal(asJSON, &out); err != nil {
+		return nil, fmt.Errorf("overlay %s: %v", path, err)
+	}
+	return out, nil
+}
+
+// applyOverlay applies the current env's overlay to a template. The overlay for a file applies
+// to every board it renders, then the overlay for a single board of an expanded file (e.g.
+// services.yml#api.yml) applies on top. For each, a strategic merge (<name>.yml) is applied
+// before a JSON patch (<name>.patch.yml). An overlaid template is re-rendered to YAML, and
+// hashed from that, so a change to an overlay counts as a change to the board.
+func (fs *FileSystem) applyOverlay(parsed Template, values map[string]interface{}) (Template, error) {
+	if fs.Env == "" {
+		return parsed, nil
+	}
+	bases := []string{strings.TrimSuffix(parsed.Source, ".yml")}
+	if parsed.Path != parsed.Source {
+		bases = append(bases, strings.TrimSuffix(parsed.Source, ".yml")+parsed.Path[len(parsed.Source):])
+	}
+
+	var doc interface{}
+	applied := []string{}
+	for _, base := range bases {
+		for _, suffix := range []string{".yml", jsonPatchSuffix} {
+			path := fs.overlayPath(base + suffix)
+			data, ok := fs.overlayDataMap[path]
+			if !ok {
+				continue
+			}
+			if doc == nil {
+				contents, err := toJSONMap(parsed.Contents)
+				if err != nil {
+					return Template{}, err
+				}
+				doc = contents
+			}
+			patch, err := renderOverlayFile(path, data, values)
+			if err != nil {
+				return Template{}, err
+			}
+			if suffix == jsonPatchSuffix {
+				doc, err = applyJSONPatch(doc, patch)
+			} else {
+				doc = strategicMerge(doc, patch)
+			}
+			if err != nil {
+				return Template{}, fmt.Errorf("overlay %s: %v", path, err)
+			}
+			applied = append(applied, path)
+		}
+	}
+	if len(applied) == 0 {
+		return parsed, nil
+	}
+
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return Template{}, err
+	}
+	contents := make(map[string]interface{})
+	if err = yaml.Unmarshal(data, &contents); err != nil {
+		return Template{}, err
+	}
+	parsed.Contents = contents
+	parsed.Data = append([]byte("---\n"), data...)
+	parsed.Hash = sha512.Sum512(parsed.Data)
+	parsed.Dependencies = append(parsed.Dependencies, applied...)
+	return parsed, nil
+}
+
+// withoutDirective returns a copy of a patch map without its $patch directive.
+func withoutDirective(patch map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(patch))
+	for k, v := range patch {
+		if k != "$patch" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// strategicMerge merges a patch into base, kubernetes style. Maps are merged key by key, and a
+// null value removes a key. Lists of maps that share a merge key are merged item by item, items
+// in the patch with $patch: delete are removed, and items that don't match are appended. Any
+// other value, or a map with $patch: replace replaces what's in base.
+func strategicMerge(base interface{}, patch interface{}) interface{} {
+	switch typed := patch.(type) {
+	case map[string]interface{}:
+		baseMap, ok := base.(map[string]interface{})
+		if !ok || typed["$patch"] == "replace" {
+			return withoutDirective(typed)
+		}
+		merged := make(map[string]interface{}, len(baseMap))
+		for k, v := range baseMap {
+			merged[k] = v
+		}
+		for k, v := range typed {
+			if k == "$patch" {
+				continue
+			}
+			if v == nil {
+				delete(merged, k)
+				continue
+			}
+			merged[k] = strategicMerge(merged[k], v)
+		}
+		return merged
+	case []interface{}:
+		baseList, ok := base.([]interface{})
+		key := mergeKey(typed)
+		if !ok || key == "" {
+			replaced := make([]interface{}, 0, len(typed))
+			for _, item := range typed {
+				if itemMap, isMap := item.(map[string]interface{}); isMap {
+					if itemMap["$patch"] == "delete" {
+						continue
+					}
+					item = withoutDirective(itemMap)
+				}
+				replaced = append(replaced, item)
+			}
+			return replaced
+		}
+		return mergeList(baseList, typed, key)
+	}
+	return patch
+}
+
+// mergeKey finds the key every item of a patch list can be matched on, or "" if there isn't one.
+func mergeKey(patch []interface{}) string {
+	if len(patch) == 0 {
+		return ""
+	}
+	for _, key := range mergeKeys {
+		found := true
+		for _, item := range patch {
+			itemMap, ok := item.(map[string]interface{})
+			if !ok {
+				found = false
+				break
+			}
+			if _, ok := itemMap[key].(string); !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			return key
+		}
+	}
+	return ""
+}
+
+// mergeList merges a patch list into a base list, matching items on key.
+func mergeList(base []interface{}, patch []interface{}, key string) []interface{} {
+	merged := make([]interface{}, len(base))
+	copy(merged, base)
+	deleted := make(map[int]bool)
+	for _, item := range patch {
+		patchItem := item.(map[string]interface{})
+		matched := -1
+		for i, baseItem := range merged {
+			if baseMap, ok := baseItem.(map[string]interface{}); ok && baseMap[key] == patchItem[key] {
+				matched = i
+				break
+			}
+		}
+		switch {
+		case patchItem["$patch"] == "delete":
+			if matched >= 0 {
+				deleted[matched] = true
+			}
+		case matched >= 0:
+			merged[matched] = strategicMerge(merged[matched], patchItem)
+		default:
+			merged = append(merged, withoutDirective(patchItem))
+		}
+	}
+	out := make([]interface{}, 0, len(merged))
+	for i, item := range merged {
+		if !deleted[i] {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// jsonPatchOp is a single operation of a JSON patch (RFC 6902).
+type jsonPatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from"`
+	Value interface{} `json:"value"`
+}
+
+// applyJSONPatch applies a JSON patch (RFC 6902) to a document. Supports add, remove, replace,
+// move, copy, and test.
+func applyJSONPatch(doc interface{}, patch interface{}) (interface{}, error) {
+	asJSON, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	var ops []jsonPatchOp
+	if err = json.Unmarshal(asJSON, &ops); err != nil {
+		return nil, fmt.Errorf("a JSON patch must be a list of operations: %v", err)
+	}
+
+	for i, op := range ops {
+		path, err := splitPointer(op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %v", i+1, err)
+		}
+		switch op.Op {
+		case "add":
+			doc, err = editPointer(doc, path, addEdit(op.Value))
+		case "remove":
+			doc, err = editPointer(doc, path, removeEdit)
+		case "replace":
+			doc, err = editPointer(doc, path, replaceEdit(op.Value))
+		case "move", "copy":
+			var from []string
+			var value interface{}
+			if from, err = splitPointer(op.From); err != nil {
+				break
+			}
+			if value, err = getPointer(doc, from); err != nil {
+				break
+			}
+			if op.Op == "move" {
+				if doc, err = editPointer(doc, from, removeEdit); err != nil {
+					break
+				}
+			} else {
+				value = deepCopyJSON(value)
+			}
+			doc, err = editPointer(doc, path, addEdit(value))
+		case "test":
+			var value interface{}
+			if value, err = getPointer(doc, path); err == nil && !reflect.DeepEqual(value, op.Value) {
+				err = fmt.Errorf("test failed, %s is %v not %v", op.Path, value, op.Value)
+			}
+		default:
+			err = fmt.Errorf("unknown op %q", op.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %v", i+1, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+// deepCopyJSON copies a JSON value, so a copied value can be edited on its own.
+func deepCopyJSON(value interface{}) interface{} {
+	data, _ := json.Marshal(value)
+	var out interface{}
+	json.Unmarshal(data, &out)
+	return out
+}
+
+// splitPointer splits a JSON pointer (RFC 6901) into its reference tokens.
+func splitPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses the index of an item in a list of length n. With appending set, "-", or n
+// refer to just past the end of the list.
+func arrayIndex(token string, n int, appending bool) (int, error) {
+	if appending && token == "-" {
+		return n, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > n || (i == n && !appending) {
+		return 0, fmt.Errorf("no index %s in a list of %d", token, n)
+	}
+	return i, nil
+}
+
+// getPointer returns the value a JSON pointer refers to.
+func getPointer(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch typed := doc.(type) {
+		case map[string]interface{}:
+			value, ok := typed[token]
+			if !ok {
+				return nil, fmt.Errorf("no field %q", token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(typed), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = typed[i]
+		default:
+			return nil, fmt.Errorf("can't look up %q in %v", token, doc)
+		}
+	}
+	return doc, nil
+}
+
+// pointerEdit edits the value of key in container, returning the edited container.
+type pointerEdit func(container interface{}, key string) (interface{}, error)
+
+// editPointer walks to the container of the value a JSON pointer refers to, and edits it. The
+// document with the edit made is returned, as editing a list may replace it.
+func editPointer(doc interface{}, tokens []string, edit pointerEdit) (interface{}, error) {
+	if len(tokens) == 0 {
+		// The root itself, which is edited as the only value of a container.
+		root, err := edit(map[string]interface{}{"": doc}, "")
+		if err != nil {
+			return nil, err
+		}
+		return root.(map[string]interface{})[""], nil
+	}
+	if len(tokens) == 1 {
+		return edit(doc, tokens[0])
+	}
+	child, err := getPointer(doc, tokens[:1])
+	if err != nil {
+		return nil, err
+	}
+	edited, err := editPointer(child, tokens[1:], edit)
+	if err != nil {
+		return nil, err
+	}
+	switch typed := doc.(type) {
+	case map[string]interface{}:
+		typed[tokens[0]] = edited
+	case []interface{}:
+		i, _ := arrayIndex(tokens[0], len(typed), false)
+		typed[i] = edited
+	}
+	return doc, nil
+}
+
+// addEdit adds a value, inserting it into a list, or setting it on a map.
+func addEdit(value interface{}) pointerEdit {
+	return func(container interface{}, key string) (interface{}, error) {
+		switch typed := container.(type) {
+		case map[string]interface{}:
+			typed[key] = value
+			return typed, nil
+		case []interface{}:
+			i, err := arrayIndex(key, len(typed), true)
+			if err != nil {
+				return nil, err
+			}
+			added := make([]interface{}, 0, len(typed)+1)
+			added = append(added, typed[:i]...)
+			added = append(added, value)
+			return append(added, typed[i:]...), nil
+		}
+		return nil, fmt.Errorf("can't add %q to %v", key, container)
+	}
+}
+
+// removeEdit removes a value that must exist.
+func removeEdit(container interface{}, key string) (interface{}, error) {
+	switch typed := container.(type) {
+	case map[string]interface{}:
+		if _, ok := typed[key]; !ok {
+			return nil, fmt.Errorf("no field %q", key)
+		}
+		delete(typed, key)
+		return typed, nil
+	case []interface{}:
+		i, err := arrayIndex(key, len(typed), false)
+		if err != nil {
+			return nil, err
+		}
+		removed := make([]interface{}, 0, len(typed)-1)
+		removed = append(removed, typed[:i]...)
+		return append(removed, typed[i+1:]...), nil
+	}
+	return nil, fmt.Errorf("can't remove %q from %v", key, container)
+}
+
+// replaceEdit replaces a value that must exist.
+func replaceEdit(value interface{}) pointerEdit {
+	return func(container interface{}, key string) (interface{}, error) {
+		if _, err := getPointer(container, []string{key}); err != nil {
+			return nil, err
+		}
+		switch typed := container.(type) {
+		case map[string]interface{}:
+			typed[key] = value
+		case []interface{}:
+			i, _ := arrayIndex(key, len(typed), false)
+			typed[i] = value
+		}
+		return container, nil
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// jsonValue parses JSON for a test, so expected values have the same types as a patched doc.
+func jsonValue(t *testing.T, data string) interface{} {
+	var out interface{}
+	if err := json.Unmarshal([]byte(data), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestStrategicMerge(t *testing.T) {
+	base := jsonValue(t, `{
+		"title": "Service",
+		"description": "staging",
+		"read_only": true,
+		"graphs": [
+			{"title": "CPU", "definition": {"viz": "timeseries"}},
+			{"title": "Memory", "definition": {"viz": "timeseries"}},
+			{"title": "Disk", "definition": {"viz": "timeseries"}}
+		],
+		"template_variables": [{"name": "env", "default": "staging"}]
+	}`)
+	patch := jsonValue(t, `{
+		"description": "prod",
+		"read_only": null,
+		"graphs": [
+			{"title": "CPU", "definition": {"viz": "heatmap"}},
+			{"title": "Disk", "$patch": "delete"},
+			{"title": "Network", "definition": {"viz": "timeseries"}}
+		],
+		"template_variables": [{"name": "env", "default": "prod"}]
+	}`)
+	expected := jsonValue(t, `{
+		"title": "Service",
+		"description": "prod",
+		"graphs": [
+			{"title": "CPU", "definition": {"viz": "heatmap"}},
+			{"title": "Memory", "definition": {"viz": "timeseries"}},
+			{"title": "Network", "definition": {"viz": "timeseries"}}
+		],
+		"template_variables": [{"name": "env", "default": "prod"}]
+	}`)
+	if merged := strategicMerge(base, patch); !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("Strategic merge was wrong: [ %+v ]", merged)
+	}
+
+	replaced := strategicMerge(base, jsonValue(t, `{"graphs": [{"definition": {"viz": "toplist"}}]}`))
+	if graphs := replaced.(map[string]interface{})["graphs"].([]interface{}); len(graphs) != 1 {
+		t.Fatalf("List without a merge key wasn't replaced: [ %+v ]", graphs)
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	doc := jsonValue(t, `{"title": "Service", "tags": ["a", "b"], "nested": {"x/y": 1}}`)
+	patch := jsonValue(t, `[
+		{"op": "test", "path": "/title", "value": "Service"},
+		{"op": "replace", "path": "/title", "value": "Service (prod)"},
+		{"op": "add", "path": "/tags/1", "value": "c"},
+		{"op": "add", "path": "/tags/-", "value": "d"},
+		{"op": "remove", "path": "/tags/0"},
+		{"op": "copy", "from": "/tags", "path": "/copied"},
+		{"op": "move", "from": "/nested/x~1y", "path": "/moved"}
+	]`)
+	expected := jsonValue(t, `{
+		"title": "Service (prod)",
+		"tags": ["c", "b", "d"],
+		"copied": ["c", "b", "d"],
+		"nested": {},
+		"moved": 1
+	}`)
+	patched, err := applyJSONPatch(doc, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(patched, expected) {
+		t.Fatalf("JSON patch was applied wrong: [ %+v ]", patched)
+	}
+
+	for _, broken := range []string{
+		`[{"op": "test", "path": "/title", "value": "Other"}]`,
+		`[{"op": "remove", "path": "/missing"}]`,
+		`[{"op": "replace", "path": "/tags/9", "value": 1}]`,
+		`[{"op": "frobnicate", "path": "/title"}]`,
+	} {
+		if _, err := applyJSONPatch(jsonValue(t, `{"title": "Service", "tags": []}`), jsonValue(t, broken)); err == nil {
+			t.Fatalf("Broken patch was applied: %s", broken)
+		}
+	}
+}
+
+func TestOverlays(t *testing.T) {
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"_values.yml": "env: staging\n",
+		"service.yml": "# greyhound: template\n---\nboard_title: Service ({{ .env }})\nwidgets:\n- type: timeseries\n  title_text: CPU\n" +
+			"  tile_def: {requests: [{q: 'avg:cpu{env:{{ .env }}}'}]}\n",
+		"_overlays/prod-us/_values.yml":       "env: prod-us\n",
+		"_overlays/prod-us/service.yml":       "widgets:\n- title_text: Errors\n  type: query_value\n",
+		"_overlays/prod-us/service.patch.yml": "- op: add\n  path: /read_only\n  value: true\n",
+	})
+	defer cleanup()
+
+	base, err := fs.GetTemplateFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base[0].Contents["board_title"] != "Service (staging)" || len(base) != 1 {
+		t.Fatalf("Base board was overlaid without an env: [ %+v ]", base)
+	}
+
+	fs.Env = "prod-us"
+	overlaid, err := fs.GetTemplateFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := ScreenKind.Payload(overlaid[0].Contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload["board_title"] != "Service (prod-us)" || payload["read_only"] != true {
+		t.Fatalf("Overlay wasn't applied: [ %+v ]", payload)
+	}
+	widgets := payload["widgets"].([]interface{})
+	if len(widgets) != 2 || !strings.Contains(string(overlaid[0].Data), "avg:cpu{env:prod-us}") {
+		t.Fatalf("Overlay didn't merge the widgets: \n%s", overlaid[0].Data)
+	}
+	if overlaid[0].Hash == base[0].Hash {
+		t.Fatal("Overlaid board has the same hash as the base board!")
+	}
+	if len(overlaid[0].Dependencies) != 2 {
+		t.Fatalf("Overlay files weren't tracked as dependencies: [ %+v ]", overlaid[0].Dependencies)
+	}
+
+	t.Run("Envs Keep Their Own State", func(t *testing.T) {
+		if err := fs.PutState(BoardState{"src/configs/service.yml", "screen", "2", ""}); err != nil {
+			t.Fatal(err)
+		}
+		fs.Env = ""
+		state, err := fs.GetState("src/configs/service.yml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state != nil {
+			t.Fatalf("State of an env leaked into the base: [ %+v ]", state)
+		}
+	})
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// partialsDir is the directory under RootDir partials are read from.
+const partialsDir = "_partials"
+
+// isPartialFile reports if a file is a partial, rather than a board.
+func (fs *FileSystem) isPartialFile(path string) bool {
+	rel, err := filepath.Rel(filepath.Join(fs.RootDir, partialsDir), path)
+	return err == nil && !strings.HasPrefix(rel, "..")
+}
+
+// partialPath returns the file a partial is read from, e.g. jvm/health is
+// _partials/jvm/health.yml.
+func (fs *FileSystem) partialPath(name string) string {
+	return filepath.Join(fs.RootDir, partialsDir, filepath.FromSlash(name)+".yml")
+}
+
+// includeResolver splices partials into a board wherever a list has an include directive:
+//
+//	graphs:
+//	- include: http-latency
+//	  with: {service: api}
+//
+// A partial marked as a template is rendered through text/template with the board's values, and
+// the with parameters on top. It may be a list of items, or a single item, and may include other
+// partials in turn.
+type includeResolver struct {
+	fs     *FileSystem
+	values map[string]interface{}
+	// The partials currently being included, to catch an include cycle.
+	stack []string
+	// Every partial file included.
+	deps map[string]bool
+}
+
+// resolve returns value with every include directive in it replaced by its partial. value
+// itself is never modified, as it may be cached.
+func (resolver *includeResolver) resolve(value interface{}) (interface{}, error) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(typed))
+		for k, v := range typed {
+			item, err := resolver.resolve(v)
+			if err != nil {
+				return nil, err
+			}
+			resolved[k] = item
+		}
+		return resolved, nil
+	case map[interface{}]interface{}:
+		resolved := make(map[interface{}]interface{}, len(typed))
+		for k, v := range typed {
+			item, err := resolver.resolve(v)
+			if err != nil {
+				return nil, err
+			}
+			resolved[k] = item
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, 0, len(typed))
+		for _, v := range typed {
+			name, params, isInclude, err := includeDirective(v)
+			if err != nil {
+				return nil, err
+			}
+			if isInclude {
+				items, err := resolver.include(name, params)
+				if err != nil {
+					return nil, err
+				}
+				resolved = append(resolved, items...)
+				continue
+			}
+			item, err := resolver.resolve(v)
+			if err != nil {
+				return nil, err
+			}
+			resolved = append(resolved, item)
+		}
+		return resolved, nil
+	}
+	return value, nil
+}
+
+// includeDirective reads an include directive out of a list item, if it is one.
+func includeDirective(item interface{}) (string, map[string]interface{}, bool, error) {
+	fields, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return "", nil, false, nil
+	}
+	include, ok := fields["include"]
+	if !ok {
+		return "", nil, false, nil
+	}
+	name, ok := include.(string)
+	if !ok || name == "" {
+		return "", nil, false, fmt.Errorf("include must be the name of a partial, got %v", include)
+	}
+	for k := range fields {
+		if k != "include" && k != "with" {
+			return "", nil, false, fmt.Errorf("include %q has unknown field %v, parameters go under with", name, k)
+		}
+	}
+	params := map[string]interface{}{}
+	if with, ok := fields["with"]; ok && with != nil {
+		if _, isMap := with.(map[interface{}]interface{}); !isMap {
+			return "", nil, false, fmt.Errorf("with of include %q must be a map", name)
+		}
+		converted, err := toJSONMap(with)
+		if err != nil {
+			return "", nil, false, err
+		}
+		params = converted
+	}
+	return name, params, true, nil
+}
+
+// include renders a partial with parameters, returning the items it adds to the list.
+func (resolver *includeResolver) include(name string, params map[string]interface{}) ([]interface{}, error) {
+	path := resolver.fs.partialPath(name)
+	data, ok := resolver.fs.partialDataMap[path]
+	if !ok {
+		return nil, fmt.Errorf("unknown partial %q, expected it at %s", name, path)
+	}
+	for _, including := range resolver.stack {
+		if including == name {
+			return nil, fmt.Errorf("include cycle: %s -> %s", strings.Join(resolver.stack, " -> "), name)
+		}
+	}
+
+	values := make(map[string]interface{}, len(resolver.values)+len(params))
+	for k, v := range resolver.values {
+		values[k] = v
+	}
+	for k, v := range params {
+		values[k] = v
+	}
+	rendered, err := renderTemplate(name, data, values)
+	if err != nil {
+		return nil, fmt.Errorf("partial %q: %v", name, err)
+	}
+	var parsed interface{}
+	if err = yaml.Unmarshal(rendered, &parsed); err != nil {
+		return nil, fmt.Errorf("partial %q: %v", name, err)
+	}
+
+	var items []interface{}
+	switch typed := parsed.(type) {
+	case nil:
+		items = []interface{}{}
+	case []interface{}:
+		items = typed
+	case map[interface{}]interface{}:
+		items = []interface{}{typed}
+	default:
+		return nil, fmt.Errorf("partial %q must be a list, or a map", name)
+	}
+
+	resolver.deps[path] = true
+	resolver.stack = append(resolver.stack, name)
+	defer func() { resolver.stack = resolver.stack[:len(resolver.stack)-1] }()
+	resolved, err := resolver.resolve(items)
+	if err != nil {
+		return nil, err
+	}
+	return resolved.([]interface{}), nil
+}
+
+// resolveIncludes splices every partial a template includes into it. A template that includes
+// anything is re-rendered to YAML with its partials in place, and hashed from that, so a change
+// to a partial counts as a change to every board that uses it.
+func (fs *FileSystem) resolveIncludes(parsed Template, values map[string]interface{}) (Template, error) {
+	resolver := &includeResolver{fs: fs, values: values, deps: make(map[string]bool)}
+	resolved, err := resolver.resolve(parsed.Contents)
+	if err != nil {
+		return Template{}, err
+	}
+	if len(resolver.deps) == 0 {
+		return parsed, nil
+	}
+
+	parsed.Contents = resolved.(map[string]interface{})
+	data, err := yaml.Marshal(parsed.Contents)
+	if err != nil {
+		return Template{}, err
+	}
+	parsed.Data = append([]byte("---\n"), data...)
+	parsed.Hash = sha512.Sum512(parsed.Data)
+	parsed.Dependencies = []string{}
+	for dep := range resolver.deps {
+		parsed.Dependencies = append(parsed.Dependencies, dep)
+	}
+	sort.Strings(parsed.Dependencies)
+	return parsed, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestPartials(t *testing.T) {
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"_values.yml": "team: core\n",
+		"_partials/http/latency.yml": "# greyhound: template\n{{ range list \"p50\" \"p99\" }}\n" +
+			"- title: {{ $.service }} {{ . }} latency\n" +
+			"  definition:\n" +
+			"    requests:\n" +
+			"    - q: {{ . }}:{{ $.service }}.latency{team:{{ $.team }}}\n" +
+			"{{ end }}",
+		"_partials/overview.yml": "# greyhound: template\n- include: http/latency\n  with: {service: {{ .service }}}\n" +
+			"- title: Errors\n  definition: {requests: []}\n",
+		"api.yml": "---\ndash:\n  title: API\n  graphs:\n" +
+			"  - include: overview\n    with: {service: api}\n" +
+			"  - title: Custom\n    definition: {requests: []}\n",
+		"plain.yml": "---\ndash:\n  title: Plain\n  graphs: []\n",
+	})
+	defer cleanup()
+
+	templates, err := fs.GetTemplateFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 2 {
+		t.Fatalf("Partials were rendered as boards: [ %+v ]", templates)
+	}
+	api := templates[0]
+	payload, err := DashKind.Payload(api.Contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := []string{}
+	for _, graph := range payload["graphs"].([]interface{}) {
+		titles = append(titles, graph.(map[string]interface{})["title"].(string))
+	}
+	if !reflect.DeepEqual(titles, []string{"api p50 latency", "api p99 latency", "Errors", "Custom"}) {
+		t.Fatalf("Partials weren't spliced into the graphs: [ %+v ]", titles)
+	}
+	if !strings.Contains(string(api.Data), "p99:api.latency{team:core}") {
+		t.Fatalf("Rendered data doesn't have the partial in place: \n%s", api.Data)
+	}
+	expectedDeps := []string{"src/configs/_partials/http/latency.yml", "src/configs/_partials/overview.yml"}
+	if !reflect.DeepEqual(api.Dependencies, expectedDeps) {
+		t.Fatalf("Partials weren't tracked as dependencies: [ %+v ]", api.Dependencies)
+	}
+	if templates[1].Dependencies != nil {
+		t.Fatalf("Board without includes has dependencies: [ %+v ]", templates[1].Dependencies)
+	}
+
+	t.Run("Changing A Partial Changes The Hash", func(t *testing.T) {
+		before := api.Hash
+		plainBefore := templates[1].Hash
+		afero.WriteFile(fs.appFs, "src/configs/_partials/overview.yml", []byte("- title: Errors\n  definition: {requests: []}\n"), 0644)
+		changed, err := fs.GetTemplateFiles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed[0].Hash == before {
+			t.Fatal("Changing a partial didn't change the hash of the board using it!")
+		}
+		if changed[1].Hash != plainBefore {
+			t.Fatal("Changing a partial changed the hash of a board not using it!")
+		}
+	})
+}
+
+func TestPlainPartials(t *testing.T) {
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"_partials/host.yml": "- title: Host\n  definition: {requests: [], text: 'Alerting on {{host.name}}'}\n",
+		"api.yml":            "---\ndash:\n  title: API\n  graphs:\n  - include: host\n",
+	})
+	defer cleanup()
+
+	templates, err := fs.GetTemplateFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := DashKind.Payload(templates[0].Contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph := payload["graphs"].([]interface{})[0].(map[string]interface{})
+	if text := graph["definition"].(map[string]interface{})["text"]; text != "Alerting on {{host.name}}" {
+		t.Fatalf("Datadog's template variables in a partial weren't kept: [ %+v ]", graph)
+	}
+}
+
+func TestPartialErrors(t *testing.T) {
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"_partials/a.yml": "- include: b\n",
+		"_partials/b.yml": "- include: a\n",
+		"cycle.yml":       "---\nboard_title: Cycle\nwidgets:\n- include: a\n",
+		"missing.yml":     "---\nboard_title: Missing\nwidgets:\n- include: nope\n",
+		"extra.yml":       "---\nboard_title: Extra\nwidgets:\n- include: a\n  service: api\n",
+	})
+	defer cleanup()
+
+	_, err := fs.GetTemplateFiles()
+	errs, ok := err.(FileErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("Every broken include wasn't reported: [ %+v ]", err)
+	}
+	for i, expected := range []string{"include cycle: a -> b -> a", "unknown field service", `unknown partial "nope"`} {
+		if !strings.Contains(errs[i].Error(), expected) {
+			t.Fatalf("Expected [ %s ] in: %v", expected, errs[i])
+		}
+	}
+}
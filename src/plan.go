@@ -0,0 +1,370 @@
+package main
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"time"
+)
+
+// PlanAction is what applying a plan will do to a single board.
+type PlanAction string
+
+const (
+	// ActionCreate creates a brand new board.
+	ActionCreate PlanAction = "create"
+	// ActionUpdate changes a board that already exists.
+	ActionUpdate PlanAction = "update"
+	// ActionNoop leaves a board alone, it already matches.
+	ActionNoop PlanAction = "no-op"
+	// ActionDelete deletes a board whose file has been removed.
+	ActionDelete PlanAction = "delete"
+)
+
+// PlanChange is what will happen to a single board when a plan is applied.
+type PlanChange struct {
+	Action PlanAction
+	Kind   BoardKind
+	// The YAML file the board comes from.
+	File  string
+	Title string
+	// The ID of the live board, empty when creating.
+	ID string
+	// The body that will be sent to Datadog.
+	Payload map[string]interface{}
+	// The fields that differ from the live board.
+	Diffs []FieldDiff
+	// The hash of the file, recorded in state once applied.
+	Hash [sha512.Size]byte
+
+	// The FileSystem the state of the board is recorded in.
+	fs *FileSystem
+	// forget drops the state of a board that was already deleted by someone else.
+	forget bool
+}
+
+// Plan is the set of changes needed to make Datadog match what's in YAML.
+type Plan struct {
+	Changes []PlanChange
+}
+
+// BuildPlan compares every template in fs against the live boards of a kind. Files that
+// haven't changed since they were last applied are planned as a no-op without asking
+// Datadog, unless opts.Force is set. If opts.Prune is set, boards whose file was removed
+// are planned for deletion. With opts.KeepGoing, files that fail are left out of the plan,
+// and returned as FileErrors alongside it.
+func (client *DatadogConnector) BuildPlan(kind BoardKind, fs *FileSystem, opts SyncOptions) (*Plan, error) {
+	collector := &errorCollector{keepGoing: opts.KeepGoing}
+	templates, err := fs.GetTemplateFiles()
+	if err = collector.add(err); err != nil {
+		return nil, err
+	}
+
+	lazy := &lazyBoardIndex{client: client, kind: kind}
+	plan, err := client.planTemplates(kind, fs, templates, lazy, collector, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Prune {
+		claimed := make(map[string]bool)
+		for _, change := range plan.Changes {
+			if change.ID != "" {
+				claimed[change.ID] = true
+			}
+		}
+		deletions, err := client.prunePlan(kind, fs, lazy, claimed)
+		if err != nil {
+			return nil, err
+		}
+		plan.Changes = append(plan.Changes, deletions...)
+	}
+
+	return plan, collector.result()
+}
+
+// planTemplates plans the changes for some of the templates of a kind, which must already have
+// been rendered by fs. Files that fail are added to collector, the error returned stops the
+// plan.
+func (client *DatadogConnector) planTemplates(kind BoardKind, fs *FileSystem, templates []Template, lazy *lazyBoardIndex, collector *errorCollector, opts SyncOptions) (*Plan, error) {
+	plan := &Plan{}
+	// Changes without a FileSystem don't record their state once they're applied.
+	stateFs := fs
+	if opts.SkipState {
+		stateFs = nil
+	}
+	// Files that haven't changed keep the titles of their boards, so a new file can't take over
+	// one of them through its title, whichever order the files are in.
+	states := make([]*BoardState, len(templates))
+	unchangedTitles := make([]string, len(templates))
+	seenTitles := make(map[string]string)
+	for i, template := range templates {
+		if opts.SkipState {
+			continue
+		}
+		state, err := fs.GetState(template.Path)
+		if err != nil {
+			return nil, err
+		}
+		states[i] = state
+		if !opts.Force && state.unchanged(kind, template.Hash) {
+			// A file that no longer renders fails once it changes, until then it keeps its title.
+			_, title, _ := kind.payloadAndTitle(template)
+			if title != "" && seenTitles[title] == "" {
+				seenTitles[title] = template.Path
+			}
+			unchangedTitles[i] = title
+		}
+	}
+
+	for i, template := range templates {
+		state := states[i]
+		if !opts.Force && state.unchanged(kind, template.Hash) {
+			plan.Changes = append(plan.Changes, PlanChange{
+				Action: ActionNoop,
+				Kind:   kind,
+				File:   template.Path,
+				Title:  unchangedTitles[i],
+				ID:     state.ID,
+				Hash:   template.Hash,
+				fs:     stateFs,
+			})
+			continue
+		}
+		payload, title, err := kind.payloadAndTitle(template)
+		if err == nil && payload != nil && seenTitles[title] != "" {
+			err = fmt.Errorf("%s %q is already defined in %s", kind.Name, title, seenTitles[title])
+		}
+		if err != nil {
+			if err = collector.addFile(template.Path, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if payload == nil {
+			continue
+		}
+		seenTitles[title] = template.Path
+		index, err := lazy.get()
+		if err != nil {
+			return nil, err
+		}
+
+		change := PlanChange{
+			Action:  ActionCreate,
+			Kind:    kind,
+			File:    template.Path,
+			Title:   title,
+			Payload: payload,
+			Hash:    template.Hash,
+			fs:      stateFs,
+		}
+		if board, ok := index.match(kind, state, title); ok {
+			change.Action = ActionUpdate
+			change.ID = board.ID
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	// Diffing every existing board means fetching it, so the fetches are spread over the pool.
+	errs := runPool(opts.Concurrency, len(plan.Changes), opts.KeepGoing, func(i int) error {
+		change := &plan.Changes[i]
+		if change.Action != ActionUpdate {
+			return nil
+		}
+		current, err := client.forFile(change.File).GetBoard(kind, change.ID)
+		if err != nil {
+			return &FileError{change.File, err}
+		}
+		if change.Diffs = diffBoard(kind, change.Payload, current); len(change.Diffs) == 0 {
+			change.Action = ActionNoop
+		}
+		return nil
+	})
+	fetched := plan.Changes[:0]
+	for i, err := range errs {
+		if err != nil {
+			if err = collector.add(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		fetched = append(fetched, plan.Changes[i])
+	}
+	plan.Changes = fetched
+	return plan, nil
+}
+
+// PrunePlan plans the deletion of every board of a kind that Greyhound created, but whose file
+// has since been removed. Boards Greyhound never recorded owning, like ones built by hand in the
+// UI, are never touched.
+func (client *DatadogConnector) PrunePlan(kind BoardKind, fs *FileSystem) (*Plan, error) {
+	if err := fs.RenderTemplates(); err != nil {
+		if _, ok := err.(FileErrors); !ok {
+			return nil, err
+		}
+	}
+	deletions, err := client.prunePlan(kind, fs, &lazyBoardIndex{client: client, kind: kind}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Plan{deletions}, nil
+}
+
+// prunePlan plans the deletion of the boards of a kind whose file was removed. The templates
+// must already have been rendered. A board that another file owns, or that's in claimed, only
+// has its stale state forgotten, as it was taken over (e.g. by a file expanded into many boards).
+func (client *DatadogConnector) prunePlan(kind BoardKind, fs *FileSystem, lazy *lazyBoardIndex, claimed map[string]bool) ([]PlanChange, error) {
+	orphans, err := fs.orphanedStates(kind)
+	if err != nil {
+		return nil, err
+	}
+	owned, err := fs.claimedIDs(kind)
+	if err != nil {
+		return nil, err
+	}
+	deletions := []PlanChange{}
+	for _, orphan := range orphans {
+		index, err := lazy.get()
+		if err != nil {
+			return nil, err
+		}
+		change := PlanChange{Action: ActionDelete, Kind: kind, File: orphan.Path, ID: orphan.ID, fs: fs}
+		if board, ok := index.byID[orphan.ID]; ok && !owned[orphan.ID] && !claimed[orphan.ID] {
+			change.Title = board.Title
+		} else {
+			change.Action = ActionNoop
+			change.forget = true
+		}
+		deletions = append(deletions, change)
+	}
+	return deletions, nil
+}
+
+// result is the result of the change before it's carried out, without an action.
+func (change PlanChange) result() BoardResult {
+	return BoardResult{File: change.File, Kind: change.Kind.Name, Title: change.Title, ID: change.ID}
+}
+
+// Count returns how many changes in the plan will perform a given action.
+func (plan *Plan) Count(action PlanAction) int {
+	count := 0
+	for _, change := range plan.Changes {
+		if change.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// HasChanges reports if applying the plan would change anything at all.
+func (plan *Plan) HasChanges() bool {
+	for _, change := range plan.Changes {
+		if change.Action != ActionNoop || change.forget {
+			return true
+		}
+	}
+	return false
+}
+
+// Write prints the plan out in a human readable diff.
+func (plan *Plan) Write(w io.Writer) {
+	for _, change := range plan.Changes {
+		switch change.Action {
+		case ActionCreate:
+			fmt.Fprintf(w, "  + %s %q (%s)\n", change.Kind.Name, change.Title, change.File)
+		case ActionUpdate:
+			fmt.Fprintf(w, "  ~ %s %q (%s) [id: %s]\n", change.Kind.Name, change.Title, change.File, change.ID)
+			for _, diff := range change.Diffs {
+				fmt.Fprintf(w, "      %s\n", diff)
+			}
+		case ActionDelete:
+			fmt.Fprintf(w, "  - %s %q (%s) [id: %s]\n", change.Kind.Name, change.Title, change.File, change.ID)
+		}
+	}
+	fmt.Fprintf(w, "Plan: %d to add, %d to change, %d to destroy.\n",
+		plan.Count(ActionCreate), plan.Count(ActionUpdate), plan.Count(ActionDelete))
+}
+
+// ApplyPlan carries out every change in a plan, and nothing else. Every board in the plan
+// has its state recorded, including ones that already matched, and deleted boards have their
+// state removed. Changes are applied by opts.Concurrency workers at once. With opts.KeepGoing
+// every change is attempted, and the ones that failed are returned as FileErrors.
+func (client *DatadogConnector) ApplyPlan(plan *Plan, opts SyncOptions) error {
+	_, err := client.applyPlan(plan, opts)
+	return err
+}
+
+// applyPlan is ApplyPlan, also returning the result of every change that was attempted, in the
+// order of the plan. Changes that only forget stale state aren't about a board, so have no
+// result.
+func (client *DatadogConnector) applyPlan(plan *Plan, opts SyncOptions) ([]BoardResult, error) {
+	collector := &errorCollector{keepGoing: opts.KeepGoing}
+	results := make([]BoardResult, len(plan.Changes))
+	errs := runPool(opts.Concurrency, len(plan.Changes), opts.KeepGoing, func(i int) error {
+		start := time.Now()
+		change := plan.Changes[i]
+		// Every call writes to its own index, so results needs no lock.
+		results[i] = change.result()
+		url, err := client.applyChange(change, &results[i])
+		results[i].URL = url
+		results[i].DurationMS = int64(time.Since(start) / time.Millisecond)
+		if err != nil {
+			results[i].Action = ResultFailed
+			results[i].Error = err.Error()
+		} else if change.forget {
+			results[i].Action = ""
+		}
+		return err
+	})
+
+	attempted := []BoardResult{}
+	for i, err := range errs {
+		if results[i].Action != "" {
+			attempted = append(attempted, results[i])
+		}
+		if err = collector.add(err); err != nil {
+			return attempted, err
+		}
+	}
+	return attempted, collector.result()
+}
+
+// applyChange carries out a single change in a plan, filling in the action taken, and the ID
+// of the board on result. The URL of the board is returned. Failures talking to Datadog are
+// returned as a FileError naming the file the change is for.
+func (client *DatadogConnector) applyChange(change PlanChange, result *BoardResult) (string, error) {
+	client = client.forFile(change.File)
+	if change.Action == ActionDelete {
+		if err := client.DoJSONRequest("DELETE", fmt.Sprintf("%s/%s", change.Kind.APIPath, change.ID), nil, nil); err != nil {
+			return "", &FileError{change.File, err}
+		}
+		result.Action = ResultDeleted
+	}
+	if change.Action == ActionDelete || change.forget {
+		return "", change.fs.DeleteState(change.File)
+	}
+
+	id, url := change.ID, ""
+	switch change.Action {
+	case ActionCreate, ActionUpdate:
+		var err error
+		if id, url, err = client.writeBoard(change.Kind, change.ID, change.Payload); err != nil {
+			return "", &FileError{change.File, err}
+		}
+		result.ID = id
+		result.Action = ResultUpdated
+		if change.Action == ActionCreate {
+			result.Action = ResultCreated
+		}
+	default:
+		if id != "" {
+			url = client.boardURL(change.Kind, id, "")
+		}
+		result.Action = ResultUnchanged
+	}
+	if change.fs == nil {
+		return url, nil
+	}
+	return url, change.fs.PutState(BoardState{change.File, change.Kind.Name, id, hashString(change.Hash)})
+}
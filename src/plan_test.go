@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+// testDatadogHost is the host tests should mock Datadog on, the base URL of the site every
+// connector starts out on.
+func testDatadogHost() string {
+	return NewDatadogConnector("test", "test", 3).Site.BaseURL()
+}
+
+// createTestFileSystem creates a FileSystem backed by memory holding the given files.
+func createTestFileSystem(t *testing.T, files map[string]string) (*FileSystem, func()) {
+	dir, err := ioutil.TempDir("", "leveldb-cache-test-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsBacker := afero.NewMemMapFs()
+	fsBacker.MkdirAll("src/configs/", 0755)
+	for name, contents := range files {
+		afero.WriteFile(fsBacker, "src/configs/"+name, []byte(contents), 0644)
+	}
+
+	fs, err := CreateFileSystem("src/configs/", dir, fsBacker)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return fs, func() {
+		fs.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBuildPlan(t *testing.T) {
+	defer gock.Off()
+
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"new.yml":       "---\ndash:\n  title: New Board\n  description: new\n",
+		"changed.yml":   "---\ndash:\n  title: Changed Board\n  description: after\n",
+		"unchanged.yml": "---\ndash:\n  title: Same Board\n  description: same\n",
+	})
+	defer cleanup()
+
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash$").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"dashes": []map[string]interface{}{
+				{"id": "1", "title": "Changed Board"},
+				{"id": "2", "title": "Same Board"},
+			},
+		})
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash/1").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"dash": map[string]interface{}{"id": 1, "title": "Changed Board", "description": "before"},
+		})
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash/2").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"dash": map[string]interface{}{"id": 2, "title": "Same Board", "description": "same"},
+		})
+
+	connector := NewDatadogConnector("test", "test", 3)
+	plan, err := connector.BuildPlan(DashKind, fs, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.Count(ActionCreate) != 1 || plan.Count(ActionUpdate) != 1 || plan.Count(ActionNoop) != 1 {
+		t.Fatalf("Plan had the wrong actions: [ %+v ]", plan.Changes)
+	}
+
+	var out bytes.Buffer
+	plan.Write(&out)
+	for _, expected := range []string{
+		"+ dash \"New Board\" (src/configs/new.yml)",
+		"~ dash \"Changed Board\" (src/configs/changed.yml) [id: 1]",
+		"~ description: \"before\" => \"after\"",
+		"Plan: 1 to add, 1 to change, 0 to destroy.",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Fatalf("Plan output is missing [ %s ]: \n%s", expected, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "Same Board") {
+		t.Fatalf("Plan output contains a board with no changes: \n%s", out.String())
+	}
+}
+
+func TestBuildPlanDuplicateTitles(t *testing.T) {
+	defer gock.Off()
+
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"a.yml": "---\ndash:\n  title: Board\n",
+		"b.yml": "---\ndash:\n  title: Board\n",
+	})
+	defer cleanup()
+
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash$").
+		Reply(200).
+		JSON(map[string]interface{}{"dashes": []map[string]interface{}{}})
+
+	connector := NewDatadogConnector("test", "test", 3)
+	if _, err := connector.BuildPlan(DashKind, fs, SyncOptions{}); err == nil {
+		t.Fatal("Plan was built even though two files define the same board!")
+	}
+}
+
+func TestBuildPlanDuplicateOfUnchanged(t *testing.T) {
+	defer gock.Off()
+
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"owner.yml": "---\ndash:\n  title: Board\n",
+	})
+	defer cleanup()
+	templates, err := fs.GetTemplateFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.PutState(BoardState{"src/configs/owner.yml", "dash", "1", hashString(templates[0].Hash)}); err != nil {
+		t.Fatal(err)
+	}
+	// The copy sorts before the file that owns the board.
+	afero.WriteFile(fs.appFs, "src/configs/copy.yml", []byte("---\ndash:\n  title: Board\n"), 0644)
+
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash$").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"dashes": []map[string]interface{}{{"id": "1", "title": "Board"}},
+		})
+
+	connector := NewDatadogConnector("test", "test", 3)
+	_, err = connector.BuildPlan(DashKind, fs, SyncOptions{})
+	if err == nil || !strings.Contains(err.Error(), `dash "Board" is already defined in src/configs/owner.yml`) {
+		t.Fatalf("A new file took over the board of an unchanged one: [ %+v ]", err)
+	}
+}
+
+func TestBuildPlanFollowsState(t *testing.T) {
+	defer gock.Off()
+
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"renamed.yml": "---\ndash:\n  title: New Title\n",
+	})
+	defer cleanup()
+	if err := fs.PutState(BoardState{"src/configs/renamed.yml", "dash", "1", ""}); err != nil {
+		t.Fatal(err)
+	}
+
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash$").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"dashes": []map[string]interface{}{{"id": "1", "title": "Old Title"}},
+		})
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash/1").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"dash": map[string]interface{}{"id": 1, "title": "Old Title"},
+		})
+
+	connector := NewDatadogConnector("test", "test", 3)
+	plan, err := connector.BuildPlan(DashKind, fs, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 1 || plan.Changes[0].Action != ActionUpdate || plan.Changes[0].ID != "1" {
+		t.Fatalf("Renaming a board didn't update the board it owns: [ %+v ]", plan.Changes)
+	}
+}
+
+func TestBuildPlanRemovedField(t *testing.T) {
+	defer gock.Off()
+
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"board.yml": "---\ndash:\n  title: Board\n  description: same\n",
+	})
+	defer cleanup()
+	if err := fs.PutState(BoardState{"src/configs/board.yml", "dash", "1", "before-the-fields-were-removed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash$").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"dashes": []map[string]interface{}{{"id": "1", "title": "Board"}},
+		})
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash/1").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"dash": map[string]interface{}{
+				"id":                 1,
+				"title":              "Board",
+				"description":        "same",
+				"read_only":          true,
+				"template_variables": []interface{}{map[string]interface{}{"name": "host"}},
+				"created":            "2016-01-01T00:00:00Z",
+			},
+		})
+
+	connector := NewDatadogConnector("test", "test", 3)
+	plan, err := connector.BuildPlan(DashKind, fs, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 1 || plan.Changes[0].Action != ActionUpdate || !plan.HasChanges() {
+		t.Fatalf("Removing fields from a file didn't plan an update: [ %+v ]", plan.Changes)
+	}
+	var out bytes.Buffer
+	plan.Write(&out)
+	for _, expected := range []string{"- read_only: true", `- template_variables: [{"name":"host"}]`} {
+		if !strings.Contains(out.String(), expected) {
+			t.Fatalf("Plan output is missing [ %s ]: \n%s", expected, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "created") {
+		t.Fatalf("Server side field showed up as a removal: \n%s", out.String())
+	}
+}
+
+func TestApplyPlan(t *testing.T) {
+	defer gock.Off()
+
+	fs, cleanup := createTestFileSystem(t, map[string]string{})
+	defer cleanup()
+
+	gock.New(testDatadogHost()).
+		Post("/api/v1/dash$").
+		JSON(map[string]interface{}{"title": "New Board"}).
+		Reply(200).
+		JSON(map[string]interface{}{"dash": map[string]interface{}{"id": 5, "title": "New Board"}, "url": "/dash/5/new-board"})
+	gock.New(testDatadogHost()).
+		Put("/api/v1/screen/7$").
+		JSON(map[string]interface{}{"board_title": "Changed Board"}).
+		Reply(200).
+		JSON(map[string]interface{}{})
+
+	plan := &Plan{[]PlanChange{
+		{Action: ActionCreate, Kind: DashKind, File: "new.yml", Title: "New Board", Payload: map[string]interface{}{"title": "New Board"}, fs: fs},
+		{Action: ActionUpdate, Kind: ScreenKind, File: "changed.yml", Title: "Changed Board", ID: "7", Payload: map[string]interface{}{"board_title": "Changed Board"}, fs: fs},
+		{Action: ActionNoop, Kind: DashKind, File: "same.yml", Title: "Same Board", ID: "2", fs: fs},
+	}}
+
+	connector := NewDatadogConnector("test", "test", 3)
+	results, err := connector.applyPlan(plan, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gock.IsDone() {
+		t.Fatal("Applying the plan didn't create the new board, and update the changed one in place!")
+	}
+	expected := []BoardResult{
+		{File: "new.yml", Kind: "dash", Title: "New Board", ID: "5", URL: "https://app.datadoghq.com/dash/5/new-board", Action: ResultCreated},
+		{File: "changed.yml", Kind: "screen", Title: "Changed Board", ID: "7", URL: "https://app.datadoghq.com/screen/7", Action: ResultUpdated},
+		{File: "same.yml", Kind: "dash", Title: "Same Board", ID: "2", URL: "https://app.datadoghq.com/dash/2", Action: ResultUnchanged},
+	}
+	for i := range results {
+		results[i].DurationMS = 0
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("Applying the plan didn't report every board: [ %+v ]", results)
+	}
+
+	states, err := fs.ListStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 3 || states[1].Path != "new.yml" || states[1].ID != "5" {
+		t.Fatalf("Applying the plan didn't record state: [ %+v ]", states)
+	}
+}
+
+func TestBuildPlanSkipsUnchanged(t *testing.T) {
+	defer gock.Off()
+
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"same.yml": "---\ndash:\n  title: Same Board\n",
+	})
+	defer cleanup()
+
+	templates, err := fs.GetTemplateFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.PutState(BoardState{templates[0].Path, "dash", "1", hashString(templates[0].Hash)}); err != nil {
+		t.Fatal(err)
+	}
+
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash$").
+		Reply(200).
+		JSON(map[string]interface{}{"dashes": []map[string]interface{}{}})
+
+	connector := NewDatadogConnector("test", "test", 3)
+	plan, err := connector.BuildPlan(DashKind, fs, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 1 || plan.Changes[0].Action != ActionNoop || plan.Changes[0].ID != "1" {
+		t.Fatalf("Unchanged file wasn't planned as a no-op: [ %+v ]", plan.Changes)
+	}
+	if !gock.IsPending() {
+		t.Fatal("Planning an unchanged file still talked to Datadog!")
+	}
+}
+
+func TestPrunePlan(t *testing.T) {
+	defer gock.Off()
+
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"kept.yml": "---\ndash:\n  title: Kept Board\n",
+	})
+	defer cleanup()
+	for _, state := range []BoardState{
+		{"src/configs/kept.yml", "dash", "1", ""},
+		{"src/configs/removed.yml", "dash", "2", ""},
+		{"src/configs/already-gone.yml", "dash", "3", ""},
+		{"src/configs/screen.yml", "screen", "4", ""},
+	} {
+		if err := fs.PutState(state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gock.New(testDatadogHost()).
+		Get("/api/v1/dash$").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"dashes": []map[string]interface{}{
+				{"id": "1", "title": "Kept Board"},
+				{"id": "2", "title": "Removed Board"},
+				{"id": "5", "title": "Built By Hand"},
+			},
+		})
+
+	connector := NewDatadogConnector("test", "test", 3)
+	plan, err := connector.PrunePlan(DashKind, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Count(ActionDelete) != 1 || plan.Changes[1].ID != "2" || plan.Changes[1].Title != "Removed Board" {
+		t.Fatalf("Plan didn't delete just the removed board: [ %+v ]", plan.Changes)
+	}
+
+	var out bytes.Buffer
+	plan.Write(&out)
+	if !strings.Contains(out.String(), "- dash \"Removed Board\" (src/configs/removed.yml) [id: 2]") {
+		t.Fatalf("Plan output is missing the deletion: \n%s", out.String())
+	}
+
+	gock.New(testDatadogHost()).
+		Delete("/api/v1/dash/2$").
+		Reply(200)
+	if err = connector.ApplyPlan(plan, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !gock.IsDone() {
+		t.Fatal("Applying the plan didn't delete the removed board!")
+	}
+
+	states, err := fs.ListStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 || states[0].Path != "src/configs/kept.yml" || states[1].Path != "src/configs/screen.yml" {
+		t.Fatalf("Pruned boards were not forgotten: [ %+v ]", states)
+	}
+}
+
+func TestPrunePlanExpandedFile(t *testing.T) {
+	defer gock.Off()
+
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"services.yml": "---\nboard_title: api\nwidgets: []\n---\nboard_title: web\nwidgets: []\n",
+	})
+	defer cleanup()
+	// The file used to render just the api board.
+	if err := fs.PutState(BoardState{"src/configs/services.yml", "screen", "1", ""}); err != nil {
+		t.Fatal(err)
+	}
+
+	gock.New(testDatadogHost()).
+		Get("/api/v1/screen$").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"screenboards": []map[string]interface{}{{"id": 1, "title": "api"}},
+		})
+	gock.New(testDatadogHost()).
+		Get("/api/v1/screen/1$").
+		Reply(200).
+		JSON(map[string]interface{}{"id": 1, "board_title": "api", "widgets": []interface{}{}})
+
+	connector := NewDatadogConnector("test", "test", 3)
+	plan, err := connector.BuildPlan(ScreenKind, fs, SyncOptions{Prune: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Count(ActionDelete) != 0 || plan.Count(ActionCreate) != 1 {
+		t.Fatalf("Board taken over by the expanded file was deleted: [ %+v ]", plan.Changes)
+	}
+	forgotten := plan.Changes[len(plan.Changes)-1]
+	if forgotten.File != "src/configs/services.yml" || !forgotten.forget {
+		t.Fatalf("Stale state of the old file wasn't forgotten: [ %+v ]", plan.Changes)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import "sync"
+
+// runPool calls work for every index in [0, count), with at most size calls running at once.
+// The error from each call is returned at the same index. Once a call fails, calls that haven't
+// started yet are skipped unless keepGoing is set, so a failing run stops about as soon as it
+// would have running one at a time. Skipped calls always come after the first failure, so
+// walking the errors in order finds a failure before any call that never ran.
+func runPool(size int, count int, keepGoing bool, work func(i int) error) []error {
+	if size < 1 {
+		size = 1
+	}
+	errs := make([]error, count)
+
+	var (
+		lock   sync.Mutex
+		failed bool
+		wg     sync.WaitGroup
+	)
+	// A slot is taken before deciding whether to start each call, so a failure is always seen
+	// before the call after it starts.
+	slots := make(chan struct{}, size)
+	for i := 0; i < count; i++ {
+		slots <- struct{}{}
+		lock.Lock()
+		stop := failed
+		lock.Unlock()
+		if stop {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Every call writes to its own index, so errs needs no lock.
+			errs[i] = work(i)
+			if errs[i] != nil && !keepGoing {
+				lock.Lock()
+				failed = true
+				lock.Unlock()
+			}
+			<-slots
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
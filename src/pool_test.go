@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestRunPool(t *testing.T) {
+	t.Run("Bounds Concurrency", func(t *testing.T) {
+		var (
+			lock    sync.Mutex
+			running int
+			most    int
+		)
+		started := make(chan struct{}, 9)
+		release := make(chan struct{})
+		done := make(chan []error)
+		go func() {
+			done <- runPool(3, 9, false, func(i int) error {
+				lock.Lock()
+				running++
+				if running > most {
+					most = running
+				}
+				lock.Unlock()
+				started <- struct{}{}
+				<-release
+				lock.Lock()
+				running--
+				lock.Unlock()
+				return nil
+			})
+		}()
+		// Let the pool fill up before anything finishes, then finish one call at a time.
+		for i := 0; i < 3; i++ {
+			<-started
+		}
+		for i := 0; i < 9; i++ {
+			release <- struct{}{}
+			if i < 6 {
+				<-started
+			}
+		}
+		for _, err := range <-done {
+			if err != nil {
+				t.Fatalf("Work that succeeded reported an error: [ %+v ]", err)
+			}
+		}
+		if most != 3 {
+			t.Fatalf("Pool of 3 ran %d at once!", most)
+		}
+	})
+
+	t.Run("Stops After A Failure", func(t *testing.T) {
+		ran := 0
+		errs := runPool(1, 5, false, func(i int) error {
+			ran++
+			if i == 1 {
+				return errors.New("boom")
+			}
+			return nil
+		})
+		if ran != 2 || errs[1] == nil {
+			t.Fatalf("Pool didn't stop after the failure, ran %d: [ %+v ]", ran, errs)
+		}
+	})
+
+	t.Run("Keep Going Runs Everything", func(t *testing.T) {
+		errs := runPool(2, 5, true, func(i int) error {
+			if i%2 == 0 {
+				return errors.New("boom")
+			}
+			return nil
+		})
+		for i, err := range errs {
+			if (err != nil) != (i%2 == 0) {
+				t.Fatalf("Result %d is in the wrong place: [ %+v ]", i, errs)
+			}
+		}
+	})
+}
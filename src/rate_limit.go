@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// slowDownBelow is the fraction of the rate limit left at which the rateLimiter starts spacing
+// requests out over the rest of the window, rather than sending them as fast as it can.
+const slowDownBelow = 0.2
+
+// rateLimiter paces requests to Datadog using the X-RateLimit headers it sends back. Datadog
+// limits each group of endpoints separately, naming the limit in X-RateLimit-Name, so a window
+// is kept per limit, and requests only wait on the limit of their own endpoint. Endpoints that
+// don't name their limit get a window of their own, keyed by the endpoint (see endpointOf). Once a window is nearly
+// used up the remaining requests are spread over what's left of it, and once it's used up
+// entirely requests wait for it to reset. It's safe to share between workers.
+type rateLimiter struct {
+	lock sync.Mutex
+	// The window of every limit we've heard about, by name.
+	windows map[string]*rateWindow
+	// The name of the limit each endpoint was last told it falls under.
+	names map[string]string
+
+	// now, and sleep are swapped out in tests.
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// rateWindow is the state of a single rate limit.
+type rateWindow struct {
+	// known is set once Datadog has told us about the limit at all.
+	known     bool
+	limit     int
+	remaining int
+	// When the current window resets.
+	reset time.Time
+}
+
+// newRateLimiter creates a rateLimiter that knows nothing about the limits yet.
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		windows: make(map[string]*rateWindow),
+		names:   make(map[string]string),
+		now:     time.Now,
+		sleep:   time.Sleep,
+	}
+}
+
+// window returns the window of the limit called name, creating it if need be. The lock must be
+// held.
+func (limiter *rateLimiter) window(name string) *rateWindow {
+	window, ok := limiter.windows[name]
+	if !ok {
+		window = &rateWindow{}
+		limiter.windows[name] = window
+	}
+	return window
+}
+
+// endpointOf returns the endpoint a request to path is for, the path up to the resource, e.g.
+// /api/v1/dash for /api/v1/dash/1234. Every board of a kind is limited together, so requests for
+// one board are paced by what Datadog said about another.
+func endpointOf(path string) string {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 4)
+	if len(parts) > 3 {
+		parts = parts[:3]
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// nameFor returns the name of the limit a request to path falls under, its endpoint until
+// Datadog says otherwise. The lock must be held.
+func (limiter *rateLimiter) nameFor(path string) string {
+	endpoint := endpointOf(path)
+	if name, ok := limiter.names[endpoint]; ok {
+		return name
+	}
+	return endpoint
+}
+
+// delay works out how long the next request to path should wait, and reserves a request from
+// its window for it.
+func (limiter *rateLimiter) delay(path string) time.Duration {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	window := limiter.window(limiter.nameFor(path))
+	if !window.known {
+		return 0
+	}
+	now := limiter.now()
+	untilReset := window.reset.Sub(now)
+	if untilReset <= 0 {
+		// The window has reset, but until Datadog tells us otherwise we don't know by how much.
+		window.known = false
+		return 0
+	}
+	if window.remaining <= 0 {
+		return untilReset
+	}
+
+	wait := time.Duration(0)
+	if float64(window.remaining) < float64(window.limit)*slowDownBelow {
+		wait = untilReset / time.Duration(window.remaining)
+	}
+	window.remaining--
+	return wait
+}
+
+// wait blocks until the next request to path may be sent.
+func (limiter *rateLimiter) wait(path string) {
+	if wait := limiter.delay(path); wait > 0 {
+		limiter.sleep(wait)
+	}
+}
+
+// update records the limits Datadog sent back with the response to a request to path.
+// Responses without the headers leave things as they were. A 429 always uses up the rest of the
+// window.
+func (limiter *rateLimiter) update(path string, resp *http.Response) {
+	limit, limitErr := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	remaining, remainingErr := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	// Datadog sends the number of seconds until the window resets, not a timestamp.
+	reset, resetErr := strconv.Atoi(resp.Header.Get("X-RateLimit-Reset"))
+
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	if name := resp.Header.Get("X-RateLimit-Name"); name != "" {
+		limiter.names[endpointOf(path)] = name
+	}
+	window := limiter.window(limiter.nameFor(path))
+	if resetErr == nil {
+		window.known = true
+		window.reset = limiter.now().Add(time.Duration(reset) * time.Second)
+		if limitErr == nil {
+			window.limit = limit
+		}
+		if remainingErr == nil {
+			window.remaining = remaining
+		}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if !window.known {
+			// Nothing told us how long to wait, so back off for a second, and try again.
+			window.known = true
+			window.reset = limiter.now().Add(time.Second)
+		}
+		window.remaining = 0
+	}
+}
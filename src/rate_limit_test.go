@@ -0,0 +1,184 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+// rateLimitResponse builds a response carrying Datadog's rate limit headers.
+func rateLimitResponse(status int, limit string, remaining string, reset string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: http.Header{}}
+	resp.Header.Set("X-RateLimit-Limit", limit)
+	resp.Header.Set("X-RateLimit-Remaining", remaining)
+	resp.Header.Set("X-RateLimit-Reset", reset)
+	return resp
+}
+
+func TestRateLimiter(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	newTestLimiter := func() *rateLimiter {
+		limiter := newRateLimiter()
+		limiter.now = func() time.Time { return start }
+		return limiter
+	}
+
+	t.Run("Unknown Limits Don't Wait", func(t *testing.T) {
+		if wait := newTestLimiter().delay("/api/v1/screen"); wait != 0 {
+			t.Fatalf("Limiter waited without knowing the limits: %v", wait)
+		}
+	})
+
+	t.Run("Plenty Left Doesn't Wait", func(t *testing.T) {
+		limiter := newTestLimiter()
+		limiter.update("/api/v1/screen", rateLimitResponse(200, "100", "50", "10"))
+		if wait := limiter.delay("/api/v1/screen"); wait != 0 {
+			t.Fatalf("Limiter waited with half the window left: %v", wait)
+		}
+	})
+
+	t.Run("Nearly Used Up Spreads Requests Out", func(t *testing.T) {
+		limiter := newTestLimiter()
+		limiter.update("/api/v1/screen", rateLimitResponse(200, "100", "5", "10"))
+		if wait := limiter.delay("/api/v1/screen"); wait != 2*time.Second {
+			t.Fatalf("Limiter didn't spread 5 requests over 10 seconds: %v", wait)
+		}
+		if limiter.windows["/api/v1/screen"].remaining != 4 {
+			t.Fatalf("Limiter didn't reserve a request: %d", limiter.windows["/api/v1/screen"].remaining)
+		}
+	})
+
+	t.Run("Used Up Waits For The Reset", func(t *testing.T) {
+		limiter := newTestLimiter()
+		limiter.update("/api/v1/screen", rateLimitResponse(200, "100", "0", "7"))
+		if wait := limiter.delay("/api/v1/screen"); wait != 7*time.Second {
+			t.Fatalf("Limiter didn't wait for the window to reset: %v", wait)
+		}
+	})
+
+	t.Run("Too Many Requests Uses Up The Window", func(t *testing.T) {
+		limiter := newTestLimiter()
+		limiter.update("/api/v1/screen", rateLimitResponse(429, "100", "30", "3"))
+		if wait := limiter.delay("/api/v1/screen"); wait != 3*time.Second {
+			t.Fatalf("Limiter didn't wait after a 429: %v", wait)
+		}
+	})
+
+	t.Run("Named Limits Don't Block Each Other", func(t *testing.T) {
+		limiter := newTestLimiter()
+		used := rateLimitResponse(200, "100", "0", "7")
+		used.Header.Set("X-RateLimit-Name", "screen")
+		limiter.update("/api/v1/screen", used)
+		plenty := rateLimitResponse(200, "100", "50", "7")
+		plenty.Header.Set("X-RateLimit-Name", "dashboard")
+		limiter.update("/api/v1/dashboard", plenty)
+
+		if wait := limiter.delay("/api/v1/dashboard"); wait != 0 {
+			t.Fatalf("Limiter waited on another endpoint's limit: %v", wait)
+		}
+		if wait := limiter.delay("/api/v1/screen"); wait != 7*time.Second {
+			t.Fatalf("Limiter didn't wait for the used up limit: %v", wait)
+		}
+	})
+
+	t.Run("Paths Share The Limit They're Named Under", func(t *testing.T) {
+		limiter := newTestLimiter()
+		used := rateLimitResponse(200, "100", "0", "7")
+		used.Header.Set("X-RateLimit-Name", "screen")
+		limiter.update("/api/v1/screen", used)
+		other := &http.Response{StatusCode: 200, Header: http.Header{}}
+		other.Header.Set("X-RateLimit-Name", "screen")
+		limiter.update("/api/v1/screen/42", other)
+
+		if wait := limiter.delay("/api/v1/screen/42"); wait != 7*time.Second {
+			t.Fatalf("Limiter didn't wait for the shared limit: %v", wait)
+		}
+		if wait := limiter.delay("/api/v1/dashboard"); wait != 0 {
+			t.Fatalf("Limiter waited on a path without a limit: %v", wait)
+		}
+	})
+
+	t.Run("Boards Share The Limit Of Their Kind", func(t *testing.T) {
+		limiter := newTestLimiter()
+		limiter.update("/api/v1/dash/1", rateLimitResponse(200, "100", "5", "10"))
+		if wait := limiter.delay("/api/v1/dash/2"); wait != 2*time.Second {
+			t.Fatalf("Limiter didn't pace another dash by the limit of the first: %v", wait)
+		}
+
+		limiter.update("/api/v1/dashboard/abc-def-ghi", rateLimitResponse(429, "100", "30", "3"))
+		if wait := limiter.delay("/api/v1/dashboard/jkl-mno-pqr"); wait != 3*time.Second {
+			t.Fatalf("Limiter didn't wait after a 429 for another dashboard: %v", wait)
+		}
+		if wait := limiter.delay("/api/v1/screen/7"); wait != 0 {
+			t.Fatalf("Limiter waited on another kind's limit: %v", wait)
+		}
+	})
+
+	t.Run("Reset Windows Are Forgotten", func(t *testing.T) {
+		limiter := newTestLimiter()
+		limiter.update("/api/v1/screen", rateLimitResponse(200, "100", "0", "7"))
+		limiter.now = func() time.Time { return start.Add(8 * time.Second) }
+		if wait := limiter.delay("/api/v1/screen"); wait != 0 {
+			t.Fatalf("Limiter waited after the window reset: %v", wait)
+		}
+	})
+}
+
+func TestRateLimitedRequests(t *testing.T) {
+	t.Run("Retries A Rate Limited Post", func(t *testing.T) {
+		defer gock.Off()
+
+		gock.New(testDatadogHost()).
+			Post("/api/v1/screen$").
+			Reply(429).
+			SetHeader("X-RateLimit-Limit", "100").
+			SetHeader("X-RateLimit-Remaining", "0").
+			SetHeader("X-RateLimit-Reset", "1").
+			BodyString(`{"errors": ["Rate limit exceeded"]}`)
+		gock.New(testDatadogHost()).
+			Post("/api/v1/screen$").
+			Reply(200).
+			JSON(map[string]interface{}{"id": 42})
+
+		connector := NewDatadogConnector("test", "test", 3)
+		var slept time.Duration
+		connector.limiter.sleep = func(wait time.Duration) { slept += wait }
+
+		id, err := connector.UpsertBoard(ScreenKind, "", map[string]interface{}{"board_title": "Screen"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != "42" {
+			t.Fatalf("Retried post didn't return the created screen: %s", id)
+		}
+		if slept <= 0 || slept > time.Second {
+			t.Fatalf("Retry didn't wait for the rate limit to reset: %v", slept)
+		}
+	})
+
+	t.Run("Server Errors On Writes Aren't Retried", func(t *testing.T) {
+		defer gock.Off()
+
+		gock.New(testDatadogHost()).
+			Post("/api/v1/screen$").
+			Reply(500).
+			BodyString("oops")
+		gock.New(testDatadogHost()).
+			Post("/api/v1/screen$").
+			Reply(200).
+			JSON(map[string]interface{}{"id": 42})
+
+		connector := NewDatadogConnector("test", "test", 3)
+		_, err := connector.UpsertBoard(ScreenKind, "", map[string]interface{}{"board_title": "Screen"})
+		apiErr, ok := err.(*APIError)
+		if !ok || apiErr.StatusCode != 500 || !strings.Contains(apiErr.Body, "oops") {
+			t.Fatalf("Failed post wasn't reported as the API error: [ %+v ]", err)
+		}
+		if !gock.IsPending() {
+			t.Fatal("Post that may have been carried out was retried!")
+		}
+	})
+}
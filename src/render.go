@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+// The formats boards can be rendered in.
+const (
+	renderJSON = "json"
+	renderYAML = "yaml"
+)
+
+// RenderOptions controls how boards are rendered.
+type RenderOptions struct {
+	// Format is renderJSON, or renderYAML.
+	Format string
+	// Compact prints JSON byte for byte as it's sent to Datadog, rather than indented.
+	Compact bool
+	// OutDir is the directory to write a file per board to, rather than printing them.
+	OutDir string
+	// KeepGoing carries on past boards that fail to render.
+	KeepGoing bool
+}
+
+// renderBody renders the request body of a template, exactly as it would be sent to Datadog,
+// in the format asked for. A nil body means the template doesn't describe a board.
+func renderBody(kind BoardKind, template Template, opts RenderOptions) ([]byte, error) {
+	payload, _, err := kind.payloadAndTitle(template)
+	if err != nil || payload == nil {
+		return nil, err
+	}
+	body, err := requestBody(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.Format {
+	case renderJSON:
+		if opts.Compact {
+			return body, nil
+		}
+		// Indenting only adds whitespace, so the JSON is otherwise exactly what's sent.
+		var indented bytes.Buffer
+		if err = json.Indent(&indented, body, "", "  "); err != nil {
+			return nil, err
+		}
+		return indented.Bytes(), nil
+	case renderYAML:
+		var decoded interface{}
+		if err = json.Unmarshal(body, &decoded); err != nil {
+			return nil, err
+		}
+		data, err := yaml.Marshal(decoded)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimSuffix(data, []byte("\n")), nil
+	}
+	return nil, fmt.Errorf("Unknown format %q, expected %s, or %s", opts.Format, renderJSON, renderYAML)
+}
+
+// renderedFile is the file under an output directory a template is rendered to, e.g.
+// services.yml#api of a screen is screen/services.api.json.
+func renderedFile(kind BoardKind, fs *FileSystem, template Template, opts RenderOptions) string {
+	rel, err := filepath.Rel(fs.RootDir, templateSource(template.Path))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(templateSource(template.Path))
+	}
+	name := strings.TrimSuffix(rel, filepath.Ext(rel))
+	if template.Path != template.Source {
+		name += "." + template.Path[len(template.Source)+1:]
+	}
+	ext := ".json"
+	if opts.Format == renderYAML {
+		ext = ".yml"
+	}
+	return filepath.Join(opts.OutDir, kind.Name, name+ext)
+}
+
+// RenderBoards renders the request body of every board offline, through templating, partials,
+// and overlays. Bodies are printed to w, with the board each is for printed to errOut so w can be
+// parsed as it is, or written to a file per board under opts.OutDir. If any files are given, only
+// the boards rendered from them are rendered.
+func RenderBoards(w io.Writer, errOut io.Writer, appFs afero.Fs, boards []managedBoards, files []string, opts RenderOptions) error {
+	collector := &errorCollector{keepGoing: opts.KeepGoing}
+	matched := make(map[string]bool)
+	for _, managed := range boards {
+		templates, err := managed.fs.GetTemplateFiles()
+		if err = collector.add(err); err != nil {
+			return err
+		}
+		for _, template := range templates {
+			file, ok := selectedFile(template, files)
+			if !ok {
+				continue
+			}
+			matched[file] = true
+			body, err := renderBody(managed.kind, template, opts)
+			if err == nil && body != nil {
+				err = writeRendered(w, errOut, appFs, managed, template, body, opts)
+			}
+			if err != nil {
+				if err = collector.addFile(template.Path, err); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, file := range files {
+		if !matched[filepath.Clean(file)] {
+			return &usageError{fmt.Sprintf("No boards are rendered from: %s", file)}
+		}
+	}
+	return collector.result()
+}
+
+// writeRendered prints a rendered body to w, and the board it's for to errOut, or writes it under
+// opts.OutDir.
+func writeRendered(w io.Writer, errOut io.Writer, appFs afero.Fs, managed managedBoards, template Template, body []byte, opts RenderOptions) error {
+	if opts.OutDir == "" {
+		if _, err := fmt.Fprintf(errOut, "# %s %s\n", managed.kind.Name, template.Path); err != nil {
+			return err
+		}
+		if opts.Format == renderYAML {
+			_, err := fmt.Fprintf(w, "---\n%s\n", body)
+			return err
+		}
+		_, err := fmt.Fprintf(w, "%s\n", body)
+		return err
+	}
+
+	path := renderedFile(managed.kind, managed.fs, template, opts)
+	if err := appFs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := afero.WriteFile(appFs, path, append(body, '\n'), 0644); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "  + %s\n", path)
+	return err
+}
+
+// selectedFile reports if a template was rendered from one of the given files, or if no files
+// were given at all. The file it was rendered from is returned.
+func selectedFile(template Template, files []string) (string, bool) {
+	if len(files) == 0 {
+		return "", true
+	}
+	for _, file := range files {
+		file = filepath.Clean(file)
+		if file == filepath.Clean(template.Path) || file == filepath.Clean(template.Source) {
+			return file, true
+		}
+	}
+	return "", false
+}
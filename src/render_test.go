@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestRenderBoards(t *testing.T) {
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"overview.yml": "---\nboard_title: Overview\nwidgets:\n- type: note\n  html: hi\n",
+		"services.yml": "---\nboard_title: API\nwidgets: []\n---\nboard_title: Web\nwidgets: []\n",
+	})
+	defer cleanup()
+	boards := []managedBoards{{ScreenKind, fs}}
+
+	t.Run("Exact Body", func(t *testing.T) {
+		var out, errOut bytes.Buffer
+		opts := RenderOptions{Format: renderJSON, Compact: true}
+		if err := RenderBoards(&out, &errOut, afero.NewMemMapFs(), boards, []string{"src/configs/overview.yml"}, opts); err != nil {
+			t.Fatalf("Failed to render boards: [ %+v ]", err)
+		}
+		templates, _ := fs.GetTemplateFiles()
+		payload, _ := ScreenKind.Payload(templates[0].Contents)
+		body, _ := requestBody(payload)
+		if out.String() != string(body)+"\n" {
+			t.Fatalf("Rendered body isn't what's sent to Datadog: [ %s ]", out.String())
+		}
+		if errOut.String() != "# screen src/configs/overview.yml\n" {
+			t.Fatalf("Board wasn't named on errOut: [ %s ]", errOut.String())
+		}
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		var out, errOut bytes.Buffer
+		if err := RenderBoards(&out, &errOut, afero.NewMemMapFs(), boards, []string{"src/configs/overview.yml"}, RenderOptions{Format: renderYAML}); err != nil {
+			t.Fatalf("Failed to render boards: [ %+v ]", err)
+		}
+		expected := "---\nboard_title: Overview\nwidgets:\n- html: hi\n  type: note\n"
+		if out.String() != expected {
+			t.Fatalf("Rendered YAML wasn't right: [ %s ]", out.String())
+		}
+	})
+
+	t.Run("Out Dir", func(t *testing.T) {
+		var out, errOut bytes.Buffer
+		outFs := afero.NewMemMapFs()
+		if err := RenderBoards(&out, &errOut, outFs, boards, nil, RenderOptions{Format: renderJSON, OutDir: "rendered"}); err != nil {
+			t.Fatalf("Failed to render boards: [ %+v ]", err)
+		}
+		for _, path := range []string{"rendered/screen/overview.json", "rendered/screen/services.api.json", "rendered/screen/services.web.json"} {
+			data, err := afero.ReadFile(outFs, path)
+			if err != nil {
+				t.Fatalf("Board wasn't written to %s: [ %+v ]", path, err)
+			}
+			if !strings.Contains(string(data), "\n  \"board_title\"") {
+				t.Fatalf("Board wasn't indented: [ %s ]", data)
+			}
+		}
+	})
+
+	t.Run("Unknown File", func(t *testing.T) {
+		var out, errOut bytes.Buffer
+		err := RenderBoards(&out, &errOut, afero.NewMemMapFs(), boards, []string{"src/configs/nope.yml"}, RenderOptions{Format: renderJSON})
+		if _, ok := err.(*usageError); !ok {
+			t.Fatalf("Rendering a file with no boards wasn't an error: [ %+v ]", err)
+		}
+	})
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+// The formats a report can be written in.
+const (
+	reportJSON  = "json"
+	reportJUnit = "junit"
+)
+
+// ResultAction is what was done to a single board during a run.
+type ResultAction string
+
+const (
+	// ResultCreated means a brand new board was created.
+	ResultCreated ResultAction = "created"
+	// ResultUpdated means an existing board was updated in place.
+	ResultUpdated ResultAction = "updated"
+	// ResultUnchanged means the board already matched, and was left alone.
+	ResultUnchanged ResultAction = "unchanged"
+	// ResultDeleted means the board was deleted, as its file was removed.
+	ResultDeleted ResultAction = "deleted"
+	// ResultFailed means the board couldn't be rendered, or written to Datadog.
+	ResultFailed ResultAction = "failed"
+)
+
+// BoardResult is what happened to a single board during a run.
+type BoardResult struct {
+	// The target the board was synced to, empty when there are no targets.
+	Target string `json:"target,omitempty"`
+	// The YAML file the board comes from.
+	File  string `json:"file"`
+	Kind  string `json:"kind,omitempty"`
+	Title string `json:"title,omitempty"`
+	// The ID of the board in Datadog, empty when it failed to be created.
+	ID string `json:"id,omitempty"`
+	// The URL of the board in the web app.
+	URL        string       `json:"url,omitempty"`
+	Action     ResultAction `json:"action"`
+	DurationMS int64        `json:"duration_ms"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// Report is the result of every board in a run, for CI to pick up.
+type Report struct {
+	Results []BoardResult `json:"results"`
+}
+
+// failedResults turns the files that failed during a run into results. Errors that aren't about
+// a single file have no result.
+func failedResults(err error) []BoardResult {
+	results := []BoardResult{}
+	switch typed := err.(type) {
+	case FileErrors:
+		for _, fileErr := range typed {
+			results = append(results, failedResults(fileErr)...)
+		}
+	case *FileError:
+		results = append(results, BoardResult{File: typed.Path, Action: ResultFailed, Error: typed.Err.Error()})
+	case *ParseError:
+		results = append(results, BoardResult{File: typed.Path, Action: ResultFailed, Error: typed.Error()})
+	}
+	return results
+}
+
+// Add adds the results of a target to the report.
+func (report *Report) Add(target string, results []BoardResult) {
+	for _, result := range results {
+		result.Target = target
+		report.Results = append(report.Results, result)
+	}
+}
+
+// WriteJSON writes the report as JSON.
+func (report *Report) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// The elements of a JUnit XML report, as read by most CI systems.
+type (
+	junitSuites struct {
+		XMLName  xml.Name     `xml:"testsuites"`
+		Name     string       `xml:"name,attr"`
+		Tests    int          `xml:"tests,attr"`
+		Failures int          `xml:"failures,attr"`
+		Time     string       `xml:"time,attr"`
+		Suites   []junitSuite `xml:"testsuite"`
+	}
+	junitSuite struct {
+		Name     string      `xml:"name,attr"`
+		Tests    int         `xml:"tests,attr"`
+		Failures int         `xml:"failures,attr"`
+		Time     string      `xml:"time,attr"`
+		Cases    []junitCase `xml:"testcase"`
+		// The milliseconds taken by every case, which Time is built from.
+		total int64
+	}
+	junitCase struct {
+		Name      string        `xml:"name,attr"`
+		ClassName string        `xml:"classname,attr"`
+		Time      string        `xml:"time,attr"`
+		Failure   *junitFailure `xml:"failure,omitempty"`
+		SystemOut string        `xml:"system-out,omitempty"`
+	}
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Body    string `xml:",chardata"`
+	}
+)
+
+// junitSeconds formats a duration in milliseconds as JUnit's seconds.
+func junitSeconds(ms int64) string {
+	return fmt.Sprintf("%.3f", float64(ms)/1000)
+}
+
+// WriteJUnit writes the report as JUnit XML, with a test suite per target, and a test case per
+// board. Boards that failed are failed test cases, the action taken, and URL of every other
+// board are its output.
+func (report *Report) WriteJUnit(w io.Writer) error {
+	suites := junitSuites{Name: "greyhound"}
+	suiteIndex := map[string]int{}
+	var total int64
+	for _, result := range report.Results {
+		name := "greyhound"
+		if result.Target != "" {
+			name = "greyhound." + result.Target
+		}
+		i, ok := suiteIndex[name]
+		if !ok {
+			i = len(suites.Suites)
+			suiteIndex[name] = i
+			suites.Suites = append(suites.Suites, junitSuite{Name: name})
+		}
+		suite := &suites.Suites[i]
+
+		className := name
+		if result.Kind != "" {
+			className = name + "." + result.Kind
+		}
+		testCase := junitCase{
+			Name:      result.File,
+			ClassName: className,
+			Time:      junitSeconds(result.DurationMS),
+			SystemOut: string(result.Action),
+		}
+		if result.URL != "" {
+			testCase.SystemOut += " " + result.URL
+		}
+		if result.Action == ResultFailed {
+			testCase.Failure = &junitFailure{Message: result.Error, Body: result.Error}
+			suite.Failures++
+			suites.Failures++
+		}
+		suite.Cases = append(suite.Cases, testCase)
+		suite.Tests++
+		suite.total += result.DurationMS
+		suites.Tests++
+		total += result.DurationMS
+	}
+	suites.Time = junitSeconds(total)
+	for i := range suites.Suites {
+		suites.Suites[i].Time = junitSeconds(suites.Suites[i].total)
+	}
+
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Write writes the report to a file in a format, creating the directory it's in.
+func (report *Report) Write(appFs afero.Fs, path string, format string) error {
+	if err := appFs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := appFs.Create(path)
+	if err != nil {
+		return fmt.Errorf("Failed to write report: %v", err)
+	}
+	defer file.Close()
+	if format == reportJUnit {
+		return report.WriteJUnit(file)
+	}
+	return report.WriteJSON(file)
+}
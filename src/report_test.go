@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	report := &Report{}
+	report.Add("prod", []BoardResult{
+		{File: "screens/a.yml", Kind: "screen", Title: "A", ID: "1", URL: "https://app.datadoghq.com/screen/1", Action: ResultCreated, DurationMS: 1500},
+		{File: "screens/b.yml", Kind: "screen", Action: ResultFailed, Error: "API error 400 Bad Request"},
+	})
+	report.Add("staging", []BoardResult{
+		{File: "screens/a.yml", Kind: "screen", Title: "A", ID: "9", Action: ResultUnchanged},
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := report.WriteJSON(&buf); err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{`"target": "prod"`, `"action": "created"`, `"url": "https://app.datadoghq.com/screen/1"`, `"duration_ms": 1500`, `"error": "API error 400 Bad Request"`} {
+			if !strings.Contains(buf.String(), expected) {
+				t.Fatalf("Report is missing %s: [ %s ]", expected, buf.String())
+			}
+		}
+	})
+
+	t.Run("JUnit", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := report.WriteJUnit(&buf); err != nil {
+			t.Fatal(err)
+		}
+		var suites junitSuites
+		if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+			t.Fatalf("Report isn't XML: [ %s ]", buf.String())
+		}
+		if suites.Tests != 3 || suites.Failures != 1 || len(suites.Suites) != 2 {
+			t.Fatalf("Expected a suite per target: [ %s ]", buf.String())
+		}
+		prod := suites.Suites[0]
+		if prod.Name != "greyhound.prod" || prod.Time != "1.500" || prod.Tests != 2 || prod.Failures != 1 {
+			t.Fatalf("Suite wasn't counted: [ %+v ]", prod)
+		}
+		if prod.Cases[0].Name != "screens/a.yml" || prod.Cases[0].ClassName != "greyhound.prod.screen" || prod.Cases[0].SystemOut != "created https://app.datadoghq.com/screen/1" {
+			t.Fatalf("Created board wasn't a passing case: [ %+v ]", prod.Cases[0])
+		}
+		if prod.Cases[1].Failure == nil || prod.Cases[1].Failure.Message != "API error 400 Bad Request" {
+			t.Fatalf("Failed board wasn't a failing case: [ %+v ]", prod.Cases[1])
+		}
+	})
+
+	t.Run("Failed Files", func(t *testing.T) {
+		results := failedResults(FileErrors{
+			&FileError{"screens/a.yml", errors.New("boom")},
+			&ParseError{"screens/b.yml", errors.New("bad yaml")},
+		})
+		if len(results) != 2 || results[0].File != "screens/a.yml" || results[0].Error != "boom" || results[1].Action != ResultFailed {
+			t.Fatalf("Failed files weren't turned into results: [ %+v ]", results)
+		}
+		if results := failedResults(errors.New("Failed to list boards")); len(results) != 0 {
+			t.Fatalf("Errors about no file shouldn't have a result: [ %+v ]", results)
+		}
+	})
+}
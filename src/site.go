@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Site is a Datadog site, which decides where an org's API lives.
+type Site string
+
+// The Datadog sites, named after the domain of their web app.
+const (
+	SiteUS1 Site = "datadoghq.com"
+	SiteUS3 Site = "us3.datadoghq.com"
+	SiteUS5 Site = "us5.datadoghq.com"
+	SiteEU  Site = "datadoghq.eu"
+	SiteAP1 Site = "ap1.datadoghq.com"
+	SiteGov Site = "ddog-gov.com"
+)
+
+// siteBaseURLs is the base URL of the API of every site.
+var siteBaseURLs = map[Site]string{
+	SiteUS1: "https://api.datadoghq.com",
+	SiteUS3: "https://api.us3.datadoghq.com",
+	SiteUS5: "https://api.us5.datadoghq.com",
+	SiteEU:  "https://api.datadoghq.eu",
+	SiteAP1: "https://api.ap1.datadoghq.com",
+	SiteGov: "https://api.ddog-gov.com",
+}
+
+// siteAppURLs is the URL of the web app of every site.
+var siteAppURLs = map[Site]string{
+	SiteUS1: "https://app.datadoghq.com",
+	SiteUS3: "https://us3.datadoghq.com",
+	SiteUS5: "https://us5.datadoghq.com",
+	SiteEU:  "https://app.datadoghq.eu",
+	SiteAP1: "https://ap1.datadoghq.com",
+	SiteGov: "https://app.ddog-gov.com",
+}
+
+// siteAliases are the short names sites are known by.
+var siteAliases = map[string]Site{
+	"us1": SiteUS1,
+	"us3": SiteUS3,
+	"us5": SiteUS5,
+	"eu":  SiteEU,
+	"eu1": SiteEU,
+	"ap1": SiteAP1,
+	"gov": SiteGov,
+}
+
+// ParseSite finds the site with a name, either its domain like datadoghq.eu, or its short name
+// like eu.
+func ParseSite(name string) (Site, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if site, ok := siteAliases[name]; ok {
+		return site, nil
+	}
+	if _, ok := siteBaseURLs[Site(name)]; ok {
+		return Site(name), nil
+	}
+	return "", fmt.Errorf("Unknown Datadog site %q, expected one of: %s", name, siteNames())
+}
+
+// BaseURL is the base URL of the site's API.
+func (site Site) BaseURL() string {
+	return siteBaseURLs[site]
+}
+
+// AppURL is the URL of the site's web app, which boards are linked to.
+func (site Site) AppURL() string {
+	return siteAppURLs[site]
+}
+
+// siteNames lists every site, for errors.
+func siteNames() string {
+	names := []string{}
+	for site := range siteBaseURLs {
+		names = append(names, string(site))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestParseSite(t *testing.T) {
+	cases := map[string]string{
+		"datadoghq.com":     "https://api.datadoghq.com",
+		"us3.datadoghq.com": "https://api.us3.datadoghq.com",
+		"US5":               "https://api.us5.datadoghq.com",
+		"datadoghq.eu":      "https://api.datadoghq.eu",
+		"eu":                "https://api.datadoghq.eu",
+		"ddog-gov.com":      "https://api.ddog-gov.com",
+	}
+	for name, expected := range cases {
+		site, err := ParseSite(name)
+		if err != nil {
+			t.Fatalf("Failed to parse site %s: [ %+v ]", name, err)
+		}
+		if site.BaseURL() != expected {
+			t.Fatalf("Site %s has the wrong base URL: [ %s ]", name, site.BaseURL())
+		}
+	}
+	if _, err := ParseSite("datadoghq.de"); err == nil {
+		t.Fatalf("Unknown site wasn't an error")
+	}
+}
+
+func TestConnectorSite(t *testing.T) {
+	t.Run("Site", func(t *testing.T) {
+		defer gock.Off()
+		gock.New("https://api.datadoghq.eu").
+			Get("/api/v1/validate").
+			Reply(200).
+			JSON(map[string]interface{}{"valid": true})
+
+		connector := NewDatadogConnector("test", "test", 3)
+		connector.Site = SiteEU
+		if valid, err := connector.Validate(); err != nil || !valid {
+			t.Fatalf("Request wasn't sent to the site: [ %+v ]", err)
+		}
+	})
+
+	t.Run("Base URL", func(t *testing.T) {
+		defer gock.Off()
+		gock.New("http://localhost:8126").
+			Get("/api/v1/validate").
+			Reply(200).
+			JSON(map[string]interface{}{"valid": true})
+
+		connector := NewDatadogConnector("test", "test", 3)
+		connector.Site = SiteEU
+		connector.BaseURL = "http://localhost:8126/"
+		if valid, err := connector.Validate(); err != nil || !valid {
+			t.Fatalf("Request wasn't sent to the base URL: [ %+v ]", err)
+		}
+	})
+}
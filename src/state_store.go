@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// statePrefix prefixes every state key in the cache. Paths can never contain a NUL byte, so
+// these keys can never collide with the path -> hash entries written by updateCache.
+const statePrefix = "\x00state\x00"
+
+// envStatePrefix prefixes the state keys of an env, followed by the env, and a NUL byte. The
+// same board is a different board in each env, so each env keeps its own state.
+const envStatePrefix = "\x00envstate\x00"
+
+// stateKeyPrefix returns the prefix of every state key for the FileSystem's env.
+func (fs *FileSystem) stateKeyPrefix() string {
+	if fs.Env == "" {
+		return statePrefix
+	}
+	return envStatePrefix + fs.Env + "\x00"
+}
+
+// BoardState records which Datadog board a YAML file owns.
+type BoardState struct {
+	// The path of the YAML file, filled in from the key.
+	Path string `json:"-"`
+	// The name of the BoardKind of the board.
+	Kind string `json:"kind"`
+	// The ID of the board in Datadog.
+	ID string `json:"id"`
+	// The hex encoded sha512 hash of the file when it was last applied. Empty if Greyhound
+	// has never applied the file (e.g. it was imported).
+	Hash string `json:"hash"`
+}
+
+// hashString hex encodes a file hash the way it's stored in BoardState.
+func hashString(hash [sha512.Size]byte) string {
+	return hex.EncodeToString(hash[:])
+}
+
+// unchanged reports if a file is exactly what was last applied to its board.
+func (state *BoardState) unchanged(kind BoardKind, hash [sha512.Size]byte) bool {
+	return state != nil && state.Kind == kind.Name && state.Hash == hashString(hash)
+}
+
+// GetState returns the state recorded for a file, or nil if there is none.
+func (fs *FileSystem) GetState(path string) (*BoardState, error) {
+	data, err := fs.cache.Get([]byte(fs.stateKeyPrefix()+path), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &BoardState{}
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	state.Path = path
+	return state, nil
+}
+
+// PutState records the state for a file, replacing anything already recorded.
+func (fs *FileSystem) PutState(state BoardState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return fs.cache.Put([]byte(fs.stateKeyPrefix()+state.Path), data, nil)
+}
+
+// DeleteState forgets the state for a file. The board itself is left alone.
+func (fs *FileSystem) DeleteState(path string) error {
+	return fs.cache.Delete([]byte(fs.stateKeyPrefix()+path), nil)
+}
+
+// ListStates returns the state of every file, sorted by path.
+func (fs *FileSystem) ListStates() ([]BoardState, error) {
+	states := []BoardState{}
+	iter := fs.cache.NewIterator(util.BytesPrefix([]byte(fs.stateKeyPrefix())), nil)
+	for iter.Next() {
+		state := BoardState{}
+		if err := json.Unmarshal(iter.Value(), &state); err != nil {
+			iter.Release()
+			return nil, err
+		}
+		state.Path = strings.TrimPrefix(string(iter.Key()), fs.stateKeyPrefix())
+		states = append(states, state)
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Path < states[j].Path })
+	return states, nil
+}
+
+// orphanedStates returns the state of every board of a kind whose file no longer exists, or
+// whose file no longer renders it. This goes by the files found by the last render, so a file
+// that merely fails to render is never mistaken for one that was removed.
+func (fs *FileSystem) orphanedStates(kind BoardKind) ([]BoardState, error) {
+	states, err := fs.ListStates()
+	if err != nil {
+		return nil, err
+	}
+	orphans := []BoardState{}
+	for _, state := range states {
+		if state.Kind == kind.Name && fs.isOrphan(state.Path) {
+			orphans = append(orphans, state)
+		}
+	}
+	return orphans, nil
+}
+
+// isOrphan reports if a board's file is gone, or no longer renders the board.
+func (fs *FileSystem) isOrphan(path string) bool {
+	source := path
+	if _, exists := fs.fileHashMap[path]; !exists {
+		source = templateSource(path)
+	}
+	if _, exists := fs.fileHashMap[source]; !exists {
+		return true
+	}
+	rendered, ok := fs.renderedPaths[source]
+	if !ok {
+		return false
+	}
+	for _, renderedPath := range rendered {
+		if renderedPath == path {
+			return false
+		}
+	}
+	return true
+}
+
+// claimedIDs returns the IDs of every board of a kind that a file currently owns.
+func (fs *FileSystem) claimedIDs(kind BoardKind) (map[string]bool, error) {
+	states, err := fs.ListStates()
+	if err != nil {
+		return nil, err
+	}
+	claimed := make(map[string]bool)
+	for _, state := range states {
+		if state.Kind == kind.Name && !fs.isOrphan(state.Path) {
+			claimed[state.ID] = true
+		}
+	}
+	return claimed, nil
+}
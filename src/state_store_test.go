@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStateStore(t *testing.T) {
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"example.yml": "---\ndashboard: test",
+	})
+	defer cleanup()
+
+	// Make sure the hash cache, and the state don't trip over each other.
+	if _, err := fs.WalkDirectory(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := fs.GetState("src/configs/example.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != nil {
+		t.Fatalf("State was found for a file that was never applied: [ %+v ]", state)
+	}
+
+	expected := BoardState{"src/configs/example.yml", "dash", "1234", "abcd"}
+	if err = fs.PutState(expected); err != nil {
+		t.Fatal(err)
+	}
+	state, err = fs.GetState("src/configs/example.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state == nil || *state != expected {
+		t.Fatalf("State read back was not correct: [ %+v ]", state)
+	}
+
+	states, err := fs.ListStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(states, []BoardState{expected}) {
+		t.Fatalf("Listed states were not correct: [ %+v ]", states)
+	}
+
+	if err = fs.DeleteState("src/configs/example.yml"); err != nil {
+		t.Fatal(err)
+	}
+	states, err = fs.ListStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 0 {
+		t.Fatalf("State was still listed after being removed: [ %+v ]", states)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// dirValuesFile holds the values for every template in its directory, and below.
+	dirValuesFile = "_values.yml"
+	// fileValuesSuffix marks the values for a single template, e.g. service.values.yml holds
+	// the values for service.yml.
+	fileValuesSuffix = ".values.yml"
+)
+
+// templateDirective marks a board, partial, or overlay as a template, when it's on a line of its
+// own. Files without it are read as plain YAML, so boards that use {{ }} for Datadog's own
+// template variables, e.g. {{host.name}} in a note, keep working.
+var templateDirective = regexp.MustCompile(`(?m)^#[ \t]*greyhound:[ \t]*template[ \t]*$`)
+
+// isTemplate reports if a file is run through text/template before it's parsed.
+func isTemplate(data []byte) bool {
+	return templateDirective.Match(data)
+}
+
+// renderTemplate runs data through text/template with values if it's a template, and otherwise
+// returns it as it is.
+func renderTemplate(name string, data []byte, values map[string]interface{}) ([]byte, error) {
+	if !isTemplate(data) {
+		return data, nil
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	var rendered bytes.Buffer
+	if err = tmpl.Execute(&rendered, values); err != nil {
+		return nil, err
+	}
+	return rendered.Bytes(), nil
+}
+
+// documentSeparator splits a rendered template into its YAML documents.
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// templateFuncs are the helpers available to every template, on top of the text/template
+// builtins.
+var templateFuncs = template.FuncMap{
+	// default returns def when value is missing, or empty: {{ default "prod" (index . "env") }}
+	"default": func(def interface{}, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return def
+		}
+		return value
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	// title upper cases the first letter of every word, leaving the rest as they are.
+	"title":   func(s string) string { return cases.Title(language.Und, cases.NoLower).String(s) },
+	"trim":    strings.TrimSpace,
+	"replace": func(old string, new string, s string) string { return strings.Replace(s, old, new, -1) },
+	"join": func(sep string, items []interface{}) string {
+		strs := make([]string, 0, len(items))
+		for _, item := range items {
+			strs = append(strs, fmt.Sprint(item))
+		}
+		return strings.Join(strs, sep)
+	},
+	"slug": slugify,
+	// quote makes a value safe to drop into YAML as a string.
+	"quote": func(value interface{}) string {
+		data, _ := json.Marshal(fmt.Sprint(value))
+		return string(data)
+	},
+	"toJSON": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	// indent indents every line of s by n spaces, for nesting a block of YAML.
+	"indent": func(n int, s string) string {
+		pad := strings.Repeat(" ", n)
+		return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+	},
+	"list": func(items ...interface{}) []interface{} { return items },
+	"dict": func(pairs ...interface{}) (map[string]interface{}, error) {
+		if len(pairs)%2 != 0 {
+			return nil, fmt.Errorf("dict needs a value for every key")
+		}
+		dict := make(map[string]interface{})
+		for i := 0; i < len(pairs); i += 2 {
+			key, ok := pairs[i].(string)
+			if !ok {
+				return nil, fmt.Errorf("dict keys must be strings, got %v", pairs[i])
+			}
+			dict[key] = pairs[i+1]
+		}
+		return dict, nil
+	},
+}
+
+// isValuesFile reports if a file holds values for templates, rather than a board.
+func isValuesFile(path string) bool {
+	return filepath.Base(path) == dirValuesFile || strings.HasSuffix(path, fileValuesSuffix)
+}
+
+// valuesFor merges together the values a template is rendered with. The values files of every
+// directory from RootDir down to the template are merged in order, followed by the template's
+// own values file, so the values closest to the template win. The values files of the env's
+// overlay are merged on top of the base ones in the same way.
+func (fs *FileSystem) valuesFor(path string) (map[string]interface{}, error) {
+	files := []string{}
+	root := filepath.Clean(fs.RootDir)
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		files = append([]string{filepath.Join(dir, dirValuesFile)}, files...)
+		if dir == root || dir == "." || dir == string(filepath.Separator) {
+			break
+		}
+	}
+	files = append(files, strings.TrimSuffix(path, ".yml")+fileValuesSuffix)
+	if fs.Env != "" {
+		for _, file := range files {
+			files = append(files, fs.overlayPath(file))
+		}
+	}
+
+	values := make(map[string]interface{})
+	for _, file := range files {
+		data, ok := fs.valuesDataMap[file]
+		if !ok {
+			if data, ok = fs.overlayDataMap[file]; !ok {
+				continue
+			}
+		}
+		var parsed map[string]interface{}
+		if err := yaml.Unmarshal(data, &parsed); err != nil {
+			return nil, fmt.Errorf("failed to parse values %s: %v", file, err)
+		}
+		// Values are handed to toJSON, and friends so they need to be JSON friendly maps.
+		converted, err := toJSONMap(parsed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read values %s: %v", file, err)
+		}
+		for k, v := range converted {
+			values[k] = v
+		}
+	}
+	return values, nil
+}
+
+// documentTitle grabs the title of a rendered document, whatever kind of board it is.
+func documentTitle(doc map[string]interface{}) string {
+	if dash, ok := doc["dash"].(map[interface{}]interface{}); ok {
+		if title, ok := dash["title"].(string); ok {
+			return title
+		}
+	}
+	for _, key := range []string{"title", "board_title"} {
+		if title, ok := doc[key].(string); ok {
+			return title
+		}
+	}
+	return ""
+}
+
+// isBlankDocument reports if a document has nothing but whitespace, and comments in it.
+func isBlankDocument(doc []byte) bool {
+	for _, line := range strings.Split(string(doc), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+// renderFile runs a file through text/template with its values if it's a template, parses the
+// YAML it renders to, splices in any partials it includes, and applies the env's overlay. A file
+// that renders to a single document is a single template, named after the file. A file that
+// renders to many documents is expanded into a template per document, each named after the
+// file, and the document's title (e.g. services.yml#api).
+func (fs *FileSystem) renderFile(path string) ([]Template, error) {
+	values, err := fs.valuesFor(path)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := renderTemplate(filepath.Base(path), fs.fileDataMap[path], values)
+	if err != nil {
+		return nil, err
+	}
+
+	documents := [][]byte{}
+	for _, document := range documentSeparator.Split(string(rendered), -1) {
+		if !isBlankDocument([]byte(document)) {
+			documents = append(documents, []byte(document))
+		}
+	}
+	if len(documents) <= 1 {
+		// Hashing the whole file keeps the hash of a plain YAML file the same as it's always been.
+		parsed, err := fs.parseDocument(path, rendered)
+		if err == nil {
+			parsed, err = fs.resolveIncludes(parsed, values)
+		}
+		if err == nil {
+			parsed, err = fs.applyOverlay(parsed, values)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []Template{parsed}, nil
+	}
+
+	templates := []Template{}
+	seen := make(map[string]bool)
+	for i, document := range documents {
+		parsed, err := fs.parseDocument(path, document)
+		if err == nil {
+			parsed, err = fs.resolveIncludes(parsed, values)
+		}
+		if err == nil {
+			parsed, err = fs.applyOverlay(parsed, values)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", i+1, err)
+		}
+		name := slugify(documentTitle(parsed.Contents))
+		if documentTitle(parsed.Contents) == "" {
+			name = fmt.Sprintf("%d", i+1)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("renders more than one board named %q, give each a different title", name)
+		}
+		seen[name] = true
+		parsed.Path = path + "#" + name
+		templates = append(templates, parsed)
+	}
+	return templates, nil
+}
+
+// parseDocument parses a single rendered YAML document from a file into a template. Parsed
+// documents are cached by their hash, so unchanged boards are only ever parsed once.
+func (fs *FileSystem) parseDocument(path string, data []byte) (Template, error) {
+	hash := sha512.Sum512(data)
+	contents, ok := fs.fileRenderMap[hash]
+	if !ok {
+		contents = make(map[string]interface{})
+		if err := yaml.Unmarshal(data, &contents); err != nil {
+			return Template{}, err
+		}
+		fs.fileRenderMap[hash] = contents
+	}
+	return Template{path, path, hash, contents, data, nil}, nil
+}
+
+// templateSource returns the file a template path was rendered from.
+func templateSource(path string) string {
+	if i := strings.LastIndex(path, "#"); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/sha512"
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplateValues(t *testing.T) {
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"_values.yml":         "team: core\nenv: staging\n",
+		"service.values.yml":  "env: prod\nservice: {name: api, hosts: [a, b]}\n",
+		"service.yml":         "# greyhound: template\n---\nboard_title: {{ .service.name | upper }} ({{ .env }})\ndescription: {{ quote .team }}\nhosts: {{ join \", \" .service.hosts }}\nwidgets: []\n",
+		"nested/_values.yml":  "env: dev\n",
+		"nested/service.yml":  "# greyhound: template\n---\nboard_title: {{ .team }}-{{ .env }}\nwidgets: []\n",
+		"nested/fallback.yml": "# greyhound: template\n---\nboard_title: {{ default \"none\" (index . \"missing\") }}\nwidgets: []\n",
+	})
+	defer cleanup()
+
+	templates, err := fs.GetTemplateFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := map[string]string{}
+	for _, template := range templates {
+		titles[template.Path] = template.Contents["board_title"].(string)
+	}
+	expected := map[string]string{
+		"src/configs/service.yml":         "API (prod)",
+		"src/configs/nested/service.yml":  "core-dev",
+		"src/configs/nested/fallback.yml": "none",
+	}
+	if len(titles) != len(expected) {
+		t.Fatalf("Values files were rendered as boards: [ %+v ]", titles)
+	}
+	for path, title := range expected {
+		if titles[path] != title {
+			t.Fatalf("%s rendered the wrong title: [ %+v ]", path, titles)
+		}
+	}
+}
+
+func TestRenderTemplateExpansion(t *testing.T) {
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"services.values.yml": "services: [api, web]\n",
+		"services.yml":        "# greyhound: template\n{{ range .services }}---\nboard_title: {{ . }} Overview\nwidgets: []\n{{ end }}",
+		"static.yml":          "---\nboard_title: Static\nwidgets: []\n",
+	})
+	defer cleanup()
+
+	templates, err := fs.GetTemplateFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 3 {
+		t.Fatalf("File wasn't expanded into a board per service: [ %+v ]", templates)
+	}
+	for i, path := range []string{"src/configs/services.yml#api-overview", "src/configs/services.yml#web-overview", "src/configs/static.yml"} {
+		if templates[i].Path != path {
+			t.Fatalf("Expanded board %d was named %s not %s", i, templates[i].Path, path)
+		}
+	}
+	if templates[0].Source != "src/configs/services.yml" {
+		t.Fatalf("Expanded board doesn't know its file: %s", templates[0].Source)
+	}
+	// Plain YAML files keep hashing the same way, so their recorded state stays valid.
+	if templates[2].Hash != sha512.Sum512([]byte("---\nboard_title: Static\nwidgets: []\n")) {
+		t.Fatal("Plain YAML file's hash changed!")
+	}
+
+	t.Run("Removed Expansions Are Orphaned", func(t *testing.T) {
+		for _, path := range []string{"src/configs/services.yml#api-overview", "src/configs/services.yml#db-overview"} {
+			if err := fs.PutState(BoardState{path, "screen", path, ""}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		orphans, err := fs.orphanedStates(ScreenKind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(orphans) != 1 || orphans[0].Path != "src/configs/services.yml#db-overview" {
+			t.Fatalf("Only the removed service should be orphaned: [ %+v ]", orphans)
+		}
+	})
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"typo.yml":  "# greyhound: template\n---\nboard_title: {{ .nope }}\nwidgets: []\n",
+		"twice.yml": "---\nboard_title: Same\n---\nboard_title: Same\n",
+	})
+	defer cleanup()
+
+	_, err := fs.GetTemplateFiles()
+	errs, ok := err.(FileErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("Both broken templates weren't reported: [ %+v ]", err)
+	}
+	if !strings.Contains(errs[0].Error(), "twice.yml") || !strings.Contains(errs[0].Error(), "more than one board") {
+		t.Fatalf("Duplicate boards weren't reported: %v", errs[0])
+	}
+	if !strings.Contains(errs[1].Error(), "typo.yml") || !strings.Contains(errs[1].Error(), "nope") {
+		t.Fatalf("Missing value wasn't reported: %v", errs[1])
+	}
+
+	t.Run("Broken Templates Aren't Orphaned", func(t *testing.T) {
+		if err := fs.PutState(BoardState{"src/configs/typo.yml", "screen", "1", ""}); err != nil {
+			t.Fatal(err)
+		}
+		orphans, err := fs.orphanedStates(ScreenKind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(orphans) != 0 {
+			t.Fatalf("A file that failed to render was treated as removed: [ %+v ]", orphans)
+		}
+	})
+}
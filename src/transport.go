@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TransportOptions controls how requests reach Datadog. The zero value uses Go's default
+// transport, which honours HTTP_PROXY, HTTPS_PROXY, and NO_PROXY.
+type TransportOptions struct {
+	// Proxy is the URL of the proxy every request is sent through, e.g. http://proxy:3128.
+	Proxy string
+	// CABundle is a PEM file of certificates to trust on top of the system's, e.g. the CA of a
+	// proxy that intercepts TLS.
+	CABundle string
+	// ClientCert, and ClientKey are the PEM files of a client certificate to present to the
+	// server. They must be set together.
+	ClientCert string
+	ClientKey  string
+	// RoundTripper carries out every request itself, the other options are ignored when it's set.
+	RoundTripper http.RoundTripper
+}
+
+// isDefault reports if the options don't change anything about the default transport.
+func (opts TransportOptions) isDefault() bool {
+	return opts.RoundTripper == nil && opts.Proxy == "" && opts.CABundle == "" && opts.ClientCert == "" && opts.ClientKey == ""
+}
+
+// Transport builds the RoundTripper the options describe. Nil means the default transport.
+func (opts TransportOptions) Transport() (http.RoundTripper, error) {
+	if opts.RoundTripper != nil {
+		return opts.RoundTripper, nil
+	}
+	if opts.isDefault() {
+		return nil, nil
+	}
+
+	// The same settings as http.DefaultTransport.
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       &tls.Config{},
+	}
+
+	if opts.Proxy != "" {
+		proxy, err := url.Parse(opts.Proxy)
+		if err != nil || (proxy.Scheme != "http" && proxy.Scheme != "https") || proxy.Host == "" {
+			return nil, fmt.Errorf("Proxy %q must be a http://, or https:// URL", opts.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if opts.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := ioutil.ReadFile(opts.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA bundle: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle %s has no PEM certificates in it", opts.CABundle)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		if opts.ClientCert == "" || opts.ClientKey == "" {
+			return nil, fmt.Errorf("A client certificate needs both a certificate, and a key")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load client certificate: %v", err)
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+	return transport, nil
+}
+
+// SetTransport changes how the connector's requests reach Datadog. Every request, from
+// validating keys to writing boards, goes through the same transport.
+func (client *DatadogConnector) SetTransport(opts TransportOptions) error {
+	transport, err := opts.Transport()
+	if err != nil {
+		return err
+	}
+	client.HTTPClient.Transport = transport
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// recordingTransport answers every request itself, recording the path of each.
+type recordingTransport struct {
+	paths []string
+}
+
+func (transport *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.paths = append(transport.paths, req.Method+" "+req.URL.Path)
+	body := `{"valid": true}`
+	if strings.HasSuffix(req.URL.Path, "/v1/screen") {
+		body = `{"screenboards": [{"id": 1, "title": "Screen"}]}`
+	}
+	return &http.Response{
+		StatusCode: 200,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+		Request:    req,
+	}, nil
+}
+
+// writeTempFile writes data to a temporary file, returning its path.
+func writeTempFile(t *testing.T, data []byte) string {
+	file, err := ioutil.TempFile("", "greyhound-transport-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err = file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func TestTransport(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		transport, err := TransportOptions{}.Transport()
+		if err != nil || transport != nil {
+			t.Fatalf("No options should mean the default transport: [ %+v, %+v ]", transport, err)
+		}
+	})
+
+	t.Run("Round Tripper", func(t *testing.T) {
+		recorder := &recordingTransport{}
+		connector := NewDatadogConnector("test", "test", 3)
+		if err := connector.SetTransport(TransportOptions{RoundTripper: recorder, Proxy: "not a url"}); err != nil {
+			t.Fatalf("Failed to set transport: [ %+v ]", err)
+		}
+		if valid, err := connector.Validate(); err != nil || !valid {
+			t.Fatalf("Failed to validate: [ %+v ]", err)
+		}
+		if _, err := connector.ListBoards(ScreenKind); err != nil {
+			t.Fatalf("Failed to list boards: [ %+v ]", err)
+		}
+		if strings.Join(recorder.paths, ",") != "GET /api/v1/validate,GET /api/v1/screen" {
+			t.Fatalf("Every request should go through the transport: [ %+v ]", recorder.paths)
+		}
+	})
+
+	t.Run("Proxy", func(t *testing.T) {
+		var proxied string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			proxied = req.URL.String()
+			w.Write([]byte(`{"valid": true}`))
+		}))
+		defer proxy.Close()
+
+		connector := NewDatadogConnector("test", "test", 3)
+		connector.BaseURL = "http://datadog.invalid"
+		if err := connector.SetTransport(TransportOptions{Proxy: proxy.URL}); err != nil {
+			t.Fatalf("Failed to set transport: [ %+v ]", err)
+		}
+		if valid, err := connector.Validate(); err != nil || !valid {
+			t.Fatalf("Failed to validate through the proxy: [ %+v ]", err)
+		}
+		if proxied != "http://datadog.invalid/api/v1/validate" {
+			t.Fatalf("Request wasn't sent through the proxy: [ %s ]", proxied)
+		}
+	})
+
+	t.Run("CA Bundle", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(`{"valid": true}`))
+		}))
+		defer server.Close()
+
+		connector := NewDatadogConnector("test", "test", 3)
+		connector.BaseURL = server.URL
+		bundle := writeTempFile(t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.TLS.Certificates[0].Certificate[0]}))
+		defer os.Remove(bundle)
+		if err := connector.SetTransport(TransportOptions{CABundle: bundle}); err != nil {
+			t.Fatalf("Failed to set transport: [ %+v ]", err)
+		}
+		if valid, err := connector.Validate(); err != nil || !valid {
+			t.Fatalf("Server signed by the CA bundle wasn't trusted: [ %+v ]", err)
+		}
+	})
+
+	t.Run("Misconfiguration", func(t *testing.T) {
+		notPEM := writeTempFile(t, []byte("not a certificate"))
+		defer os.Remove(notPEM)
+		cases := map[string]TransportOptions{
+			"Bad Proxy":        {Proxy: "proxy:3128"},
+			"Missing Bundle":   {CABundle: "/nope/ca.pem"},
+			"Empty Bundle":     {CABundle: notPEM},
+			"Cert Without Key": {ClientCert: notPEM},
+			"Bad Cert":         {ClientCert: notPEM, ClientKey: notPEM},
+		}
+		for name, opts := range cases {
+			if _, err := opts.Transport(); err == nil {
+				t.Fatalf("%s wasn't an error", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// schemaType is the type of value a schema expects.
+type schemaType string
+
+const (
+	schemaObject schemaType = "object"
+	schemaArray  schemaType = "array"
+	schemaString schemaType = "string"
+	schemaNumber schemaType = "number"
+	schemaBool   schemaType = "bool"
+	schemaAny    schemaType = "any"
+)
+
+// schema is a small subset of JSON schema, just enough to describe a board. Objects only
+// check the fields they know about, Datadog has far too many optional fields to list them
+// all and we don't want to reject a board for using one we forgot.
+type schema struct {
+	Type schemaType
+	// The known fields of an object.
+	Fields map[string]*schema
+	// The fields an object must have.
+	Required []string
+	// The schema every item of an array must match.
+	Items *schema
+	// The values a string is allowed to be, if set.
+	Enum []string
+}
+
+var (
+	stringSchema = &schema{Type: schemaString}
+	numberSchema = &schema{Type: schemaNumber}
+	boolSchema   = &schema{Type: schemaBool}
+	anySchema    = &schema{Type: schemaAny}
+
+	templateVariablesSchema = &schema{
+		Type: schemaArray,
+		Items: &schema{
+			Type:     schemaObject,
+			Required: []string{"name"},
+			Fields: map[string]*schema{
+				"name":    stringSchema,
+				"prefix":  stringSchema,
+				"default": stringSchema,
+			},
+		},
+	}
+
+	requestsSchema = &schema{
+		Type: schemaArray,
+		Items: &schema{
+			Type: schemaObject,
+			Fields: map[string]*schema{
+				"q":                   stringSchema,
+				"type":                {Type: schemaString, Enum: []string{"line", "area", "bars"}},
+				"aggregator":          {Type: schemaString, Enum: []string{"avg", "max", "min", "sum"}},
+				"style":               {Type: schemaObject},
+				"conditional_formats": {Type: schemaArray},
+			},
+		},
+	}
+
+	// timeboardSchema describes a timeboard, as read from YAML.
+	timeboardSchema = &schema{
+		Type:     schemaObject,
+		Required: []string{"dash"},
+		Fields: map[string]*schema{
+			"dash": {
+				Type:     schemaObject,
+				Required: []string{"title", "description", "graphs"},
+				Fields: map[string]*schema{
+					"title":              stringSchema,
+					"description":        stringSchema,
+					"read_only":          boolSchema,
+					"template_variables": templateVariablesSchema,
+					"graphs": {
+						Type: schemaArray,
+						Items: &schema{
+							Type:     schemaObject,
+							Required: []string{"title", "definition"},
+							Fields: map[string]*schema{
+								"title": stringSchema,
+								"definition": {
+									Type:     schemaObject,
+									Required: []string{"requests"},
+									Fields: map[string]*schema{
+										"viz": {
+											Type: schemaString,
+											Enum: []string{"change", "distribution", "heatmap", "hostmap", "query_value", "timeseries", "toplist"},
+										},
+										"requests":  requestsSchema,
+										"events":    {Type: schemaArray},
+										"autoscale": boolSchema,
+										"precision": anySchema,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// screenboardSchema describes a screenboard, as read from YAML.
+	screenboardSchema = &schema{
+		Type:     schemaObject,
+		Required: []string{"board_title", "widgets"},
+		Fields: map[string]*schema{
+			"board_title":        stringSchema,
+			"description":        stringSchema,
+			"width":              numberSchema,
+			"height":             numberSchema,
+			"read_only":          boolSchema,
+			"template_variables": templateVariablesSchema,
+			"widgets": {
+				Type: schemaArray,
+				Items: &schema{
+					Type:     schemaObject,
+					Required: []string{"type"},
+					Fields: map[string]*schema{
+						"type": {
+							Type: schemaString,
+							Enum: []string{
+								"alert_graph", "alert_value", "change", "check_status", "distribution",
+								"event_stream", "event_timeline", "frame", "free_text", "heatmap", "hostmap",
+								"iframe", "image", "log_stream", "manage_status", "note", "process",
+								"query_table", "query_value", "timeseries", "toplist", "trace_service", "uptime",
+							},
+						},
+						"title_text": stringSchema,
+						"x":          numberSchema,
+						"y":          numberSchema,
+						"width":      numberSchema,
+						"height":     numberSchema,
+						"tile_def":   {Type: schemaObject},
+					},
+				},
+			},
+		},
+	}
+
+	// dashboardSchema describes a dashboard from the unified dashboard API, as read from YAML.
+	dashboardSchema = &schema{
+		Type:     schemaObject,
+		Required: []string{"title", "layout_type", "widgets"},
+		Fields: map[string]*schema{
+			"title":              stringSchema,
+			"description":        stringSchema,
+			"layout_type":        {Type: schemaString, Enum: []string{"ordered", "free"}},
+			"reflow_type":        {Type: schemaString, Enum: []string{"auto", "fixed"}},
+			"is_read_only":       boolSchema,
+			"notify_list":        {Type: schemaArray, Items: stringSchema},
+			"template_variables": templateVariablesSchema,
+			"widgets": {
+				Type: schemaArray,
+				Items: &schema{
+					Type:     schemaObject,
+					Required: []string{"definition"},
+					Fields: map[string]*schema{
+						"definition": {
+							Type:     schemaObject,
+							Required: []string{"type"},
+							Fields: map[string]*schema{
+								"type": {
+									Type: schemaString,
+									Enum: []string{
+										"alert_graph", "alert_value", "change", "check_status", "distribution",
+										"event_stream", "event_timeline", "free_text", "funnel", "geomap", "group",
+										"heatmap", "hostmap", "iframe", "image", "list_stream", "log_stream",
+										"manage_status", "note", "query_table", "query_value", "scatterplot",
+										"servicemap", "slo", "sunburst", "timeseries", "toplist", "topology_map",
+										"trace_service", "treemap",
+									},
+								},
+								"title":    stringSchema,
+								"requests": anySchema,
+								"widgets":  {Type: schemaArray},
+							},
+						},
+						"layout": {
+							Type:     schemaObject,
+							Required: []string{"x", "y", "width", "height"},
+							Fields: map[string]*schema{
+								"x":      numberSchema,
+								"y":      numberSchema,
+								"width":  numberSchema,
+								"height": numberSchema,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+)
+
+// schemaFor returns the schema boards of a kind are validated against.
+func schemaFor(kind BoardKind) (*schema, error) {
+	switch kind {
+	case DashKind:
+		return timeboardSchema, nil
+	case ScreenKind:
+		return screenboardSchema, nil
+	case DashboardKind:
+		return dashboardSchema, nil
+	}
+	return nil, fmt.Errorf("Unknown board kind: %s", kind.Name)
+}
+
+// ValidationError is a single problem found in a YAML file.
+type ValidationError struct {
+	// The YAML file the problem is in.
+	Path   string
+	Line   int
+	Column int
+	// The field the problem is with, empty for the whole document.
+	Field   string
+	Message string
+}
+
+func (err *ValidationError) Error() string {
+	if err.Field == "" {
+		return fmt.Sprintf("%s:%d:%d: %s", err.Path, err.Line, err.Column, err.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", err.Path, err.Line, err.Column, err.Field, err.Message)
+}
+
+// nodeType returns the schemaType of a yaml node, along with if the node is null.
+func nodeType(node *yamlv3.Node) (schemaType, bool) {
+	switch node.Kind {
+	case yamlv3.MappingNode:
+		return schemaObject, false
+	case yamlv3.SequenceNode:
+		return schemaArray, false
+	}
+	switch node.ShortTag() {
+	case "!!null":
+		return schemaAny, true
+	case "!!int", "!!float":
+		return schemaNumber, false
+	case "!!bool":
+		return schemaBool, false
+	}
+	return schemaString, false
+}
+
+// validateNode checks a yaml node against a schema, appending every problem found to errs.
+func validateNode(path string, field string, node *yamlv3.Node, s *schema, errs []*ValidationError) []*ValidationError {
+	for node.Kind == yamlv3.AliasNode {
+		node = node.Alias
+	}
+	fail := func(at *yamlv3.Node, field string, format string, args ...interface{}) {
+		errs = append(errs, &ValidationError{path, at.Line, at.Column, field, fmt.Sprintf(format, args...)})
+	}
+
+	actual, isNull := nodeType(node)
+	if s.Type == schemaAny || isNull {
+		return errs
+	}
+	if actual != s.Type {
+		fail(node, field, "expected %s, got %s", s.Type, actual)
+		return errs
+	}
+
+	switch s.Type {
+	case schemaObject:
+		present := make(map[string]*yamlv3.Node)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			present[node.Content[i].Value] = node.Content[i+1]
+		}
+		for _, required := range s.Required {
+			value, ok := present[required]
+			if !ok {
+				fail(node, field, "missing required field %q", required)
+				continue
+			}
+			if _, isNull := nodeType(value); isNull {
+				fail(value, joinPath(field, required), "is required, but is null")
+			}
+		}
+		keys := []string{}
+		for k := range present {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if fieldSchema, ok := s.Fields[k]; ok {
+				errs = validateNode(path, joinPath(field, k), present[k], fieldSchema, errs)
+			}
+		}
+	case schemaArray:
+		if s.Items == nil {
+			return errs
+		}
+		for i, item := range node.Content {
+			errs = validateNode(path, fmt.Sprintf("%s[%d]", field, i), item, s.Items, errs)
+		}
+	case schemaString:
+		if len(s.Enum) == 0 {
+			return errs
+		}
+		for _, allowed := range s.Enum {
+			if node.Value == allowed {
+				return errs
+			}
+		}
+		fail(node, field, "unknown value %q, expected one of: %s", node.Value, strings.Join(s.Enum, ", "))
+	}
+	return errs
+}
+
+// ValidateBoard checks the contents of a YAML file against the schema for a kind of board,
+// without talking to Datadog.
+func ValidateBoard(kind BoardKind, path string, data []byte) []*ValidationError {
+	s, err := schemaFor(kind)
+	if err != nil {
+		return []*ValidationError{{path, 0, 0, "", err.Error()}}
+	}
+
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return []*ValidationError{{path, 0, 0, "", err.Error()}}
+	}
+	if doc.Kind != yamlv3.DocumentNode || len(doc.Content) == 0 {
+		return []*ValidationError{{path, 1, 1, "", "file is empty"}}
+	}
+	return validateNode(path, "", doc.Content[0], s, nil)
+}
+
+// Validate checks every board in the FileSystem against the schema for a kind of board. Boards
+// are checked as rendered, so for a templated file the line, and column are of the rendered
+// YAML. A file that fails to render is reported as a problem at its first line.
+func (fs *FileSystem) Validate(kind BoardKind) ([]*ValidationError, error) {
+	templates, err := fs.GetTemplateFiles()
+	errs := []*ValidationError{}
+	if renderErrs, ok := err.(FileErrors); ok {
+		for _, renderErr := range renderErrs {
+			path, message := "", renderErr.Error()
+			if parseErr, ok := renderErr.(*ParseError); ok {
+				path, message = parseErr.Path, parseErr.Err.Error()
+			}
+			errs = append(errs, &ValidationError{path, 1, 1, "", message})
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, template := range templates {
+		errs = append(errs, ValidateBoard(kind, template.Path, template.Data)...)
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+	return errs, nil
+}
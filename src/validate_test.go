@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidateBoard(t *testing.T) {
+	t.Run("Valid Timeboard", func(t *testing.T) {
+		data := []byte(`---
+dash:
+  title: Board
+  description: A board
+  graphs:
+  - title: CPU
+    definition:
+      viz: timeseries
+      requests:
+      - q: avg:system.cpu.user{*}
+        type: line
+`)
+		if errs := ValidateBoard(DashKind, "board.yml", data); len(errs) != 0 {
+			t.Fatalf("Valid timeboard had errors: [ %+v ]", errs)
+		}
+	})
+
+	t.Run("Missing Title", func(t *testing.T) {
+		data := []byte(`---
+dash:
+  description: A board
+  graphs: []
+`)
+		errs := ValidateBoard(DashKind, "board.yml", data)
+		if len(errs) != 1 || errs[0].Error() != `board.yml:3:3: dash: missing required field "title"` {
+			t.Fatalf("Missing title was not reported correctly: [ %+v ]", errs)
+		}
+	})
+
+	t.Run("Wrong Types", func(t *testing.T) {
+		data := []byte(`---
+dash:
+  title: Board
+  description: A board
+  graphs:
+  - title: CPU
+    definition:
+      requests: avg:system.cpu.user{*}
+`)
+		errs := ValidateBoard(DashKind, "board.yml", data)
+		if len(errs) != 1 || errs[0].Error() != "board.yml:8:17: dash.graphs[0].definition.requests: expected array, got string" {
+			t.Fatalf("Wrong type was not reported correctly: [ %+v ]", errs)
+		}
+	})
+
+	t.Run("Unknown Widget Type", func(t *testing.T) {
+		data := []byte(`---
+board_title: Screen
+widgets:
+- type: timeseries
+- type: sparkles
+`)
+		errs := ValidateBoard(ScreenKind, "screen.yml", data)
+		if len(errs) != 1 || errs[0].Line != 5 || errs[0].Column != 9 || errs[0].Field != "widgets[1].type" {
+			t.Fatalf("Unknown widget type was not reported correctly: [ %+v ]", errs)
+		}
+	})
+
+	t.Run("Invalid YAML", func(t *testing.T) {
+		if errs := ValidateBoard(ScreenKind, "screen.yml", []byte("board_title: [")); len(errs) != 1 {
+			t.Fatalf("Invalid YAML was not reported: [ %+v ]", errs)
+		}
+	})
+}
+
+func TestFileSystemValidate(t *testing.T) {
+	fs, cleanup := createTestFileSystem(t, map[string]string{
+		"good.yml": "---\nboard_title: Screen\nwidgets: []\n",
+		"bad.yml":  "---\nwidgets: []\n",
+	})
+	defer cleanup()
+
+	errs, err := fs.Validate(ScreenKind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0].Path != "src/configs/bad.yml" {
+		t.Fatalf("Only the bad file should have errors: [ %+v ]", errs)
+	}
+}
+
+func TestValidateDashboard(t *testing.T) {
+	t.Run("Valid Dashboard", func(t *testing.T) {
+		data := []byte(`---
+title: Board
+layout_type: free
+reflow_type: fixed
+notify_list: [someone@example.com]
+widgets:
+- definition:
+    type: note
+    content: Hello
+  layout: {x: 0, y: 0, width: 10, height: 5}
+`)
+		if errs := ValidateBoard(DashboardKind, "board.yml", data); len(errs) != 0 {
+			t.Fatalf("Valid dashboard had errors: [ %+v ]", errs)
+		}
+	})
+
+	t.Run("Unknown Layout", func(t *testing.T) {
+		data := []byte(`---
+title: Board
+layout_type: grid
+widgets: []
+`)
+		errs := ValidateBoard(DashboardKind, "board.yml", data)
+		if len(errs) != 1 || errs[0].Error() != `board.yml:3:14: layout_type: unknown value "grid", expected one of: ordered, free` {
+			t.Fatalf("Unknown layout was not reported correctly: [ %+v ]", errs)
+		}
+	})
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// boardWatcher polls the directory of a kind of board for YAML files whose contents changed,
+// and re-renders only those.
+type boardWatcher struct {
+	managed managedBoards
+	// The hash of every YAML file as of the last poll, nil before the first.
+	hashes map[string][sha512.Size]byte
+	// The board files as of the last poll.
+	boards map[string]bool
+	// The templates every board file last rendered to without any problems, which the next
+	// render of the file is compared against.
+	rendered map[string][]Template
+}
+
+// changes walks the directory of the watcher, returning the board files whose contents changed
+// since the last poll, and the ones that were removed. Saving a file without changing it keeps
+// its hash the same, so it isn't returned. When a values file, partial, or overlay changes every
+// board file is returned, as any of them may render differently.
+func (watcher *boardWatcher) changes() ([]string, []string, error) {
+	fs := watcher.managed.fs
+	files, err := fs.WalkDirectory()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := fs.fileHashes()
+	boards := make(map[string]bool)
+	for _, path := range files {
+		boards[path] = true
+	}
+
+	shared := false
+	for path, hash := range hashes {
+		if previous, ok := watcher.hashes[path]; (!ok || previous != hash) && !boards[path] {
+			shared = true
+		}
+	}
+	removed := []string{}
+	for path := range watcher.hashes {
+		if _, ok := hashes[path]; ok {
+			continue
+		}
+		if watcher.boards[path] {
+			removed = append(removed, path)
+		} else {
+			shared = true
+		}
+	}
+
+	changed := []string{}
+	for _, path := range files {
+		if previous, ok := watcher.hashes[path]; shared || !ok || previous != hashes[path] {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(removed)
+	watcher.hashes = hashes
+	watcher.boards = boards
+	return changed, removed, nil
+}
+
+// validate checks the templates rendered from a file against the schema of their kind, and
+// makes sure no other file already defines a board with the same title.
+func (watcher *boardWatcher) validate(path string, templates []Template) []error {
+	kind := watcher.managed.kind
+	problems := []error{}
+	for _, template := range templates {
+		for _, validationErr := range ValidateBoard(kind, template.Path, template.Data) {
+			problems = append(problems, validationErr)
+		}
+		payload, title, err := kind.payloadAndTitle(template)
+		if err != nil {
+			problems = append(problems, &FileError{template.Path, err})
+			continue
+		}
+		if payload == nil {
+			continue
+		}
+		for other, rendered := range watcher.rendered {
+			for _, existing := range rendered {
+				if other != path && templateTitle(kind, existing) == title {
+					problems = append(problems, &FileError{template.Path, fmt.Errorf("%s %q is already defined in %s", kind.Name, title, existing.Path)})
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// templateTitle is the title of the board a template renders to, empty if it isn't a board.
+func templateTitle(kind BoardKind, template Template) string {
+	_, title, _ := kind.payloadAndTitle(template)
+	return title
+}
+
+// writeDiff prints how the boards rendered from a file changed, in the same form as a plan.
+func (watcher *boardWatcher) writeDiff(w io.Writer, before []Template, after []Template) {
+	kind := watcher.managed.kind
+	previous := make(map[string]Template)
+	for _, template := range before {
+		previous[template.Path] = template
+	}
+	for _, template := range after {
+		payload, title, _ := kind.payloadAndTitle(template)
+		if payload == nil {
+			continue
+		}
+		old, ok := previous[template.Path]
+		delete(previous, template.Path)
+		if !ok {
+			fmt.Fprintf(w, "  + %s %q (%s)\n", kind.Name, title, template.Path)
+			continue
+		}
+		oldPayload, _, _ := kind.payloadAndTitle(old)
+		diffs := diffRendered("", oldPayload, payload)
+		if len(diffs) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "  ~ %s %q (%s)\n", kind.Name, title, template.Path)
+		for _, diff := range diffs {
+			fmt.Fprintf(w, "      %s\n", diff)
+		}
+	}
+	for _, template := range before {
+		if _, ok := previous[template.Path]; ok {
+			fmt.Fprintf(w, "  - %s %q (%s)\n", kind.Name, templateTitle(kind, template), template.Path)
+		}
+	}
+}
+
+// poll re-renders, and validates the board files that changed since the last poll. Without a
+// client, how the rendered boards changed is printed. With one, every changed board that's
+// valid is written to Datadog. The first poll only renders, and validates every board.
+// Removing a file never deletes its board.
+func (watcher *boardWatcher) poll(w io.Writer, client *DatadogConnector, opts SyncOptions) error {
+	kind, fs := watcher.managed.kind, watcher.managed.fs
+	first := watcher.hashes == nil
+	changed, removed, err := watcher.changes()
+	if err != nil {
+		return err
+	}
+	if first {
+		watcher.rendered = make(map[string][]Template)
+	}
+
+	for _, path := range removed {
+		if client == nil {
+			watcher.writeDiff(w, watcher.rendered[path], nil)
+		}
+		delete(watcher.rendered, path)
+	}
+
+	valid := []Template{}
+	for _, path := range changed {
+		templates, err := fs.renderFile(path)
+		if err != nil {
+			fmt.Fprintln(w, &ParseError{path, err})
+			continue
+		}
+		problems := watcher.validate(path, templates)
+		for _, problem := range problems {
+			fmt.Fprintln(w, problem)
+		}
+		if len(problems) > 0 {
+			continue
+		}
+		before := watcher.rendered[path]
+		watcher.rendered[path] = templates
+		if first {
+			continue
+		}
+		if client == nil {
+			watcher.writeDiff(w, before, templates)
+			continue
+		}
+		valid = append(valid, templates...)
+	}
+	if client == nil || len(valid) == 0 {
+		return nil
+	}
+
+	// Every changed board is compared against Datadog, whether or not it was applied before. The
+	// org being pushed to isn't the one the state is for, so it's left for apply.
+	opts.Force, opts.KeepGoing, opts.SkipState = true, true, true
+	collector := &errorCollector{keepGoing: true}
+	plan, err := client.planTemplates(kind, fs, valid, &lazyBoardIndex{client: client, kind: kind}, collector, opts)
+	if err != nil {
+		return err
+	}
+	plan.Write(w)
+	if err = client.ApplyPlan(plan, opts); err != nil {
+		return err
+	}
+	return collector.result()
+}
+
+// watchBoards watches the directory of every kind of board, polling each time ticks fires
+// until it's closed. Without a client, how every changed board renders is printed, with one the
+// changed boards are written to Datadog. Failures are reported to errOut, and watching carries
+// on so the file can be fixed.
+func watchBoards(w io.Writer, errOut io.Writer, client *DatadogConnector, boards []managedBoards, opts SyncOptions, ticks <-chan time.Time) error {
+	watchers := []*boardWatcher{}
+	for _, managed := range boards {
+		watcher := &boardWatcher{managed: managed}
+		if err := watcher.poll(w, client, opts); err != nil {
+			return err
+		}
+		count := 0
+		for _, templates := range watcher.rendered {
+			count += len(templates)
+		}
+		fmt.Fprintf(w, "Watching %d %s boards in %s...\n", count, managed.kind.Name, managed.fs.RootDir)
+		watchers = append(watchers, watcher)
+	}
+
+	for range ticks {
+		for _, watcher := range watchers {
+			if err := watcher.poll(w, client, opts); err != nil {
+				fmt.Fprintln(errOut, err)
+			}
+		}
+	}
+	return nil
+}
+
+// tickUntil forwards ticks until stop fires, and then closes the channel it returns.
+func tickUntil(ticks <-chan time.Time, stop <-chan os.Signal) <-chan time.Time {
+	forwarded := make(chan time.Time)
+	go func() {
+		defer close(forwarded)
+		for {
+			select {
+			case tick := <-ticks:
+				select {
+				case forwarded <- tick:
+				case <-stop:
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return forwarded
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+const (
+	watchedBoard = "---\nboard_title: Watched\ndescription: before\nwidgets: []\n"
+	changedBoard = "---\nboard_title: Watched\nwidgets: []\nread_only: true\n"
+)
+
+func TestWatch(t *testing.T) {
+	t.Run("Prints Rendered Diff", func(t *testing.T) {
+		fs, cleanup := createTestFileSystem(t, map[string]string{"a.yml": watchedBoard})
+		defer cleanup()
+
+		var out bytes.Buffer
+		watcher := &boardWatcher{managed: managedBoards{ScreenKind, fs}}
+		if err := watcher.poll(&out, nil, SyncOptions{}); err != nil || out.Len() != 0 {
+			t.Fatalf("First poll should only render: [ %s, %+v ]", out.String(), err)
+		}
+
+		afero.WriteFile(fs.appFs, "src/configs/a.yml", []byte(watchedBoard), 0644)
+		if err := watcher.poll(&out, nil, SyncOptions{}); err != nil || out.Len() != 0 {
+			t.Fatalf("Saving without changing anything should be ignored: [ %s, %+v ]", out.String(), err)
+		}
+
+		afero.WriteFile(fs.appFs, "src/configs/a.yml", []byte(changedBoard), 0644)
+		afero.WriteFile(fs.appFs, "src/configs/b.yml", []byte("---\nboard_title: New\nwidgets: []\n"), 0644)
+		if err := watcher.poll(&out, nil, SyncOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		expected := `  ~ screen "Watched" (src/configs/a.yml)
+      - description: "before"
+      + read_only: true
+  + screen "New" (src/configs/b.yml)
+`
+		if out.String() != expected {
+			t.Fatalf("Rendered diff wasn't printed: [ %s ]", out.String())
+		}
+
+		out.Reset()
+		fs.appFs.Remove("src/configs/b.yml")
+		if err := watcher.poll(&out, nil, SyncOptions{}); err != nil || out.String() != "  - screen \"New\" (src/configs/b.yml)\n" {
+			t.Fatalf("Removed board wasn't printed: [ %s, %+v ]", out.String(), err)
+		}
+	})
+
+	t.Run("Reports Problems", func(t *testing.T) {
+		fs, cleanup := createTestFileSystem(t, map[string]string{"a.yml": watchedBoard})
+		defer cleanup()
+
+		var out bytes.Buffer
+		watcher := &boardWatcher{managed: managedBoards{ScreenKind, fs}}
+		if err := watcher.poll(&out, nil, SyncOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		afero.WriteFile(fs.appFs, "src/configs/a.yml", []byte("---\nboard_title: Watched\n"), 0644)
+		afero.WriteFile(fs.appFs, "src/configs/b.yml", []byte("---\nboard_title: Watched\nwidgets: []\n"), 0644)
+		if err := watcher.poll(&out, nil, SyncOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), "src/configs/a.yml:2:1: missing required field \"widgets\"") {
+			t.Fatalf("Invalid board wasn't reported: [ %s ]", out.String())
+		}
+		if !strings.Contains(out.String(), `src/configs/b.yml: screen "Watched" is already defined in src/configs/a.yml`) {
+			t.Fatalf("Duplicate title wasn't reported: [ %s ]", out.String())
+		}
+
+		// A board with problems is compared against the last render that didn't have any.
+		out.Reset()
+		afero.WriteFile(fs.appFs, "src/configs/a.yml", []byte(changedBoard), 0644)
+		if err := watcher.poll(&out, nil, SyncOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), `- description: "before"`) {
+			t.Fatalf("Fixed board wasn't compared against its last good render: [ %s ]", out.String())
+		}
+	})
+
+	t.Run("Pushes Changed Boards", func(t *testing.T) {
+		defer gock.Off()
+		gock.New(testDatadogHost()).
+			Get("/api/v1/screen$").
+			Reply(200).
+			JSON(map[string]interface{}{"screenboards": []interface{}{
+				map[string]interface{}{"id": 7, "title": "Watched"},
+			}})
+		gock.New(testDatadogHost()).
+			Get("/api/v1/screen/7$").
+			Reply(200).
+			JSON(map[string]interface{}{"id": 7, "board_title": "Watched", "description": "before", "widgets": []interface{}{}})
+		gock.New(testDatadogHost()).
+			Put("/api/v1/screen/7$").
+			JSON(map[string]interface{}{"board_title": "Watched", "widgets": []interface{}{}, "read_only": true}).
+			Reply(200).
+			JSON(map[string]interface{}{})
+
+		fs, cleanup := createTestFileSystem(t, map[string]string{"a.yml": watchedBoard, "other.yml": "---\nboard_title: Other\nwidgets: []\n"})
+		defer cleanup()
+		// The board deployed by apply, in another org.
+		deployed := BoardState{"src/configs/a.yml", "screen", "1", "deployed"}
+		if err := fs.PutState(deployed); err != nil {
+			t.Fatal(err)
+		}
+
+		var out, errOut bytes.Buffer
+		ticks := make(chan time.Time)
+		done := make(chan error)
+		connector := NewDatadogConnector("test", "test", 3)
+		go func() {
+			done <- watchBoards(&out, &errOut, connector, []managedBoards{{ScreenKind, fs}}, SyncOptions{}, ticks)
+		}()
+
+		// The first tick is only taken once watching has started.
+		ticks <- time.Now()
+		afero.WriteFile(fs.appFs, "src/configs/a.yml", []byte(changedBoard), 0644)
+		ticks <- time.Now()
+		ticks <- time.Now()
+		close(ticks)
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+
+		if !gock.IsDone() || errOut.Len() != 0 {
+			t.Fatalf("Changed board wasn't pushed: [ %s%s ]", out.String(), errOut.String())
+		}
+		if !strings.Contains(out.String(), "Watching 2 screen boards in src/configs/...") || !strings.Contains(out.String(), "Plan: 0 to add, 1 to change, 0 to destroy.") {
+			t.Fatalf("Push wasn't printed: [ %s ]", out.String())
+		}
+		state, err := fs.GetState("src/configs/a.yml")
+		if err != nil || state == nil || *state != deployed {
+			t.Fatalf("Pushed board was recorded in the cache apply uses: [ %+v, %+v ]", state, err)
+		}
+	})
+}